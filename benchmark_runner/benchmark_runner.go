@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"log"
 	"math"
+	"net/http"
 	"os"
 	"sort"
 	"strings"
@@ -55,6 +56,10 @@ type BenchmarkRunner struct {
 	end             time.Time
 	file            *os.File
 	maxTokenSizeMB  uint
+	// percentiles is the --percentiles list; quantiles its parsed form
+	percentiles  string
+	quantiles    []quantile
+	inputReaders uint
 	// time-based run support
 	Duration time.Duration
 
@@ -68,11 +73,26 @@ type BenchmarkRunner struct {
 	// cap and loses increments under concurrent (unlocked) RecordValue.
 	totalOps uint64
 
+	// input read-speed accounting for --do-benchmark=false. inputRows,
+	// inputBytes and parseNanos are summed atomically from every worker's Stat;
+	// scanTime and scanStall are the scanner's wall time and the part of it
+	// spent blocked on workers.
+	inputRows  uint64
+	inputBytes uint64
+	parseNanos uint64
+	scanTime   time.Duration
+	scanStall  time.Duration
+
 	// maxLatencySeconds caps the highest trackable latency for every HDR
-	// histogram. Configurable via --max-latency-seconds. Converted to µs at
-	// histogram-allocation time.
+	// histogram. Configurable via --max-latency-seconds. Converted to the
+	// latency unit at histogram-allocation time.
 	maxLatencySeconds int64
 
+	// latencyUnitName is --latency-unit, parsed into latencyUnit, the unit
+	// latencies are recorded in (µs unless set to ns)
+	latencyUnitName string
+	latencyUnit     time.Duration
+
 	br *bufio.Reader
 
 	// histogramsMutex guards the plain per-label/total/inst histograms, which are
@@ -85,14 +105,63 @@ type BenchmarkRunner struct {
 	stopReport      chan struct{}
 	reportDone      chan struct{}
 
+	// detailedMapHistograms, inst_detailedMapHistograms and detailedTs are
+	// keyed by "LABEL-queryId" and guarded by detailedMapHistogramsMutex. The
+	// inst_ histograms are turned into a detailedTs datapoint and reset every
+	// reporting period, like the per-label inst_ histograms.
 	detailedMapHistogramsMutex sync.RWMutex
 	detailedMapHistograms      map[string]*hdrhistogram.Histogram
-	setupWriteHistogram        *hdrhistogram.Histogram
-	inst_setupWriteHistogram   *hdrhistogram.Histogram
-	setupWriteTs               []DataPoint
+	inst_detailedMapHistograms map[string]*hdrhistogram.Histogram
+	detailedTs                 map[string][]DataPoint
+	// failed commands per error class, overall and per "LABEL-queryId", with
+	// their interval counterparts for errorsTs and the detailedTs datapoints.
+	// Also guarded by detailedMapHistogramsMutex; allocated on the first error.
+	errorClasses              errorCounts
+	inst_errorClasses         errorCounts
+	detailedErrorClasses      map[string]errorCounts
+	inst_detailedErrorClasses map[string]errorCounts
+	errorsTs                  []DataPoint
+	// outcomeHistograms splits the OverallQuantiles latencies between
+	// successful and failed commands; also guarded by
+	// detailedMapHistogramsMutex. latencyIncludeErrors is
+	// --latency-include-errors.
+	outcomeHistograms    map[string]*outcomeHistograms
+	latencyIncludeErrors bool
+	// replyStats holds the captured reply sizes and result counts per
+	// "LABEL-queryId"; also guarded by detailedMapHistogramsMutex
+	replyStats map[string]*replyStats
+	// pipelineStats holds the round-trips and amortized per-command latencies;
+	// guarded by histogramsMutex
+	pipelineStats *pipelineStats
+	// prometheusListen is --prometheus-listen; promCounters, guarded by
+	// detailedMapHistogramsMutex, are only kept when it is set
+	prometheusListen string
+	promCounters     map[string]*promQueryCounters
+	promServer       *http.Server
+	// reportFormat and reportFile are --report-format and --report-file;
+	// progress writes the records of the json and csv formats
+	reportFormat string
+	reportFile   string
+	progress     *progressWriter
+	// csvOutDir is --csv-out-dir
+	csvOutDir string
+
+	setupWriteHistogram      *hdrhistogram.Histogram
+	inst_setupWriteHistogram *hdrhistogram.Histogram
+	setupWriteTs             []DataPoint
 
 	perSecondHistograms      map[uint64]*hdrhistogram.Histogram
 	perSecondHistogramsMutex sync.RWMutex
+	// perSecondLabelHistograms splits perSecondHistograms per label, keyed by
+	// its OverallQuantiles key; also guarded by perSecondHistogramsMutex and
+	// allocated on the first command
+	perSecondLabelHistograms map[string]map[uint64]*hdrhistogram.Histogram
+	// perSecondErrorHistograms and perSecondErrorLabelHistograms hold the
+	// failed commands of the two above, so the steady-state quantiles can
+	// leave them out like OverallQuantiles do; also guarded by
+	// perSecondHistogramsMutex and allocated on the first failed command
+	perSecondErrorHistograms      map[uint64]*hdrhistogram.Histogram
+	perSecondErrorLabelHistograms map[string]map[uint64]*hdrhistogram.Histogram
 
 	writeHistogram      *hdrhistogram.Histogram
 	inst_writeHistogram *hdrhistogram.Histogram
@@ -118,6 +187,31 @@ type BenchmarkRunner struct {
 	inst_totalHistogram *hdrhistogram.Histogram
 	totalTs             []DataPoint
 
+	// hdrLogFile is --hdr-log-file; hdrLog writes it while the benchmark runs
+	hdrLogFile string
+	hdrLog     *hdrLogWriter
+
+	// connectionOps counts recorded commands per client connection id, so the
+	// balance of --clients / --connections-per-worker can be verified. Guarded
+	// by histogramsMutex.
+	connectionOps map[uint32]uint64
+
+	// perClientStats is --per-client-stats. workerStats is indexed by worker
+	// number; connectionStats is keyed by connection id and guarded by
+	// histogramsMutex.
+	perClientStats  bool
+	workerStats     []*clientStats
+	connectionStats map[uint32]*clientStats
+
+	// runtime samples the client's own CPU, goroutines, heap and GC: at the
+	// start and end of the run and, from the reporter, every reporting period
+	// (clientTs).
+	runtime *runtimeTracker
+
+	// serverStats samples the server on its own connection (serverTs), when
+	// the Benchmark supports it
+	serverStats *serverStats
+
 	testResult TestResult
 }
 
@@ -150,6 +244,10 @@ func (b *BenchmarkRunner) GetTotalsMap() map[string]interface{} {
 	//TotalTimeouts
 	configs["Timeouts"] = atomic.LoadUint64(&b.totalTimeouts)
 
+	//Errors per error class, overall and per query id
+	configs["ErrorsByClass"] = b.GetErrorClassesMap()
+	configs["ErrorsByQueryId"] = b.GetQueryIdErrorClassesMap()
+
 	//TotalTxBytes
 	configs["TxBytes"] = atomic.LoadUint64(&b.txTotalBytes)
 
@@ -276,6 +374,7 @@ func (b *BenchmarkRunner) GetTimeSeriesMap() map[string]interface{} {
 	sort.Sort(ByTimestamp(b.readCursorTs))
 	sort.Sort(ByTimestamp(b.updateTs))
 	sort.Sort(ByTimestamp(b.deleteTs))
+	sort.Sort(ByTimestamp(b.totalTs))
 
 	configs["setupWriteTs"] = b.setupWriteTs
 	configs["writeTs"] = b.writeTs
@@ -283,7 +382,68 @@ func (b *BenchmarkRunner) GetTimeSeriesMap() map[string]interface{} {
 	configs["readCursorTs"] = b.readCursorTs
 	configs["updateTs"] = b.updateTs
 	configs["deleteTs"] = b.deleteTs
+	configs[allCommandsKey+"Ts"] = b.totalTs
+
+	configs["errorsTs"] = b.errorsTs
+	if b.runtime != nil {
+		configs["clientTs"] = b.runtime.datapoints
+	}
+	if b.serverStats != nil {
+		configs["serverTs"] = b.serverStats.datapoints
+	}
+
+	// per query id series, e.g. "READ-R3Ts", next to the per-label ones
+	for k, datapoints := range b.detailedTs {
+		sort.Sort(ByTimestamp(datapoints))
+		configs[k+"Ts"] = datapoints
+	}
+
+	return configs
+}
+
+// GetInputReadStatsMap returns the input read-speed figures of a
+// --do-benchmark=false run: how fast rows were read and parsed, and how long the
+// scanner waited on the workers.
+func (l *BenchmarkRunner) GetInputReadStatsMap() map[string]interface{} {
+	configs := map[string]interface{}{}
+	took := l.end.Sub(l.start)
+	rows := atomic.LoadUint64(&l.inputRows)
+	inputBytes := atomic.LoadUint64(&l.inputBytes)
+	parseTime := time.Duration(atomic.LoadUint64(&l.parseNanos))
+
+	configs["Rows"] = rows
+	configs["Bytes"] = inputBytes
+	configs["RowsRate"] = calculateRateMetrics(int64(rows), 0, took)
+	bytesRate := calculateRateMetrics(int64(inputBytes), 0, took)
+	configs["BytesRate"] = bytesRate
+	configs["BytesRateStr"] = bytefmt.ByteSize(uint64(bytesRate))
+
+	// Scanner time per row covers line decoding and batching; the stalls spent
+	// waiting on workers are excluded. Parse time per row is the worker-side
+	// preProcessCmd cost (CSV parsing and base64 decoding), summed across workers.
+	decodePerRow, parsePerRow := 0.0, 0.0
+	if rows > 0 {
+		decodePerRow = float64((l.scanTime - l.scanStall).Microseconds()) / float64(rows)
+		parsePerRow = float64(parseTime.Nanoseconds()) / 1e3 / float64(rows)
+	}
+	configs["DecodeTimePerRowMicros"] = decodePerRow
+	configs["ParseTimePerRowMicros"] = parsePerRow
+	configs["ScannerStallSeconds"] = l.scanStall.Seconds()
+	stallRatio := 0.0
+	if l.scanTime > 0 {
+		stallRatio = l.scanStall.Seconds() / l.scanTime.Seconds()
+	}
+	configs["ScannerStallRatio"] = stallRatio
+	return configs
+}
 
+// GetConnectionCommandCountsMap returns the number of recorded commands per
+// client connection id.
+func (b *BenchmarkRunner) GetConnectionCommandCountsMap() map[uint32]uint64 {
+	configs := map[uint32]uint64{}
+	for k, v := range b.connectionOps {
+		configs[k] = v
+	}
 	return configs
 }
 
@@ -296,6 +456,24 @@ func (b *BenchmarkRunner) GetPerSecondEncodedHistogramsMap() map[uint64]string {
 	return configs
 }
 
+// GetPerSecondEncodedLabelHistogramsMap is GetPerSecondEncodedHistogramsMap
+// per label, keyed by the label's OverallQuantiles key (e.g. "write").
+func (b *BenchmarkRunner) GetPerSecondEncodedLabelHistogramsMap() map[string]map[uint64]string {
+	if len(b.perSecondLabelHistograms) == 0 {
+		return nil
+	}
+	configs := map[string]map[uint64]string{}
+	for label, histograms := range b.perSecondLabelHistograms {
+		encoded := map[uint64]string{}
+		for k := range histograms {
+			encodedV, _ := histograms[k].Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+			encoded[k] = string(encodedV)
+		}
+		configs[label] = encoded
+	}
+	return configs
+}
+
 // defaultMaxLatencySeconds is the default upper bound for HDR histogram
 // tracking. Kept at 1s for backwards compatibility with existing dashboards
 // and report consumers; raise via --max-latency-seconds (e.g. 60) when the
@@ -305,32 +483,67 @@ const defaultMaxLatencySeconds = 1
 // Histograms are allocated in initHistograms once flags have been parsed and
 // the configured cap is known.
 var loader = &BenchmarkRunner{
-	setupWriteTs:          make([]DataPoint, 0, 10),
-	writeTs:               make([]DataPoint, 0, 10),
-	updateTs:              make([]DataPoint, 0, 10),
-	readTs:                make([]DataPoint, 0, 10),
-	readCursorTs:          make([]DataPoint, 0, 10),
-	deleteTs:              make([]DataPoint, 0, 10),
-	totalTs:               make([]DataPoint, 0, 10),
-	detailedMapHistograms: make(map[string]*hdrhistogram.Histogram),
-	perSecondHistograms:   make(map[uint64]*hdrhistogram.Histogram),
-}
-
-// maxLatencyMicros returns the configured cap in microseconds. Falls back to
+	setupWriteTs:               make([]DataPoint, 0, 10),
+	writeTs:                    make([]DataPoint, 0, 10),
+	updateTs:                   make([]DataPoint, 0, 10),
+	readTs:                     make([]DataPoint, 0, 10),
+	readCursorTs:               make([]DataPoint, 0, 10),
+	deleteTs:                   make([]DataPoint, 0, 10),
+	totalTs:                    make([]DataPoint, 0, 10),
+	detailedMapHistograms:      make(map[string]*hdrhistogram.Histogram),
+	inst_detailedMapHistograms: make(map[string]*hdrhistogram.Histogram),
+	detailedTs:                 make(map[string][]DataPoint),
+	perSecondHistograms:        make(map[uint64]*hdrhistogram.Histogram),
+}
+
+// latencyUnits are the --latency-unit values, by name.
+var latencyUnits = map[string]time.Duration{
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// LatencyUnit returns the unit a Benchmark must report its AddEntry latencies
+// in: microseconds, or nanoseconds with --latency-unit ns.
+func (l *BenchmarkRunner) LatencyUnit() time.Duration {
+	if l.latencyUnit == 0 {
+		return time.Microsecond
+	}
+	return l.latencyUnit
+}
+
+// latencyUnitString returns the name of LatencyUnit, as in --latency-unit.
+func (l *BenchmarkRunner) latencyUnitString() string {
+	if l.LatencyUnit() == time.Nanosecond {
+		return "ns"
+	}
+	return "us"
+}
+
+// latencyToMillis converts a recorded latency to milliseconds.
+func (l *BenchmarkRunner) latencyToMillis(v int64) float64 {
+	return float64(v) / l.unitsPerMilli()
+}
+
+// unitsPerMilli is how many latency units make a millisecond.
+func (l *BenchmarkRunner) unitsPerMilli() float64 {
+	return float64(time.Millisecond / l.LatencyUnit())
+}
+
+// maxLatency returns the configured cap in the latency unit. Falls back to
 // the default when the flag was not registered (e.g., direct programmatic use).
-func (l *BenchmarkRunner) maxLatencyMicros() int64 {
+func (l *BenchmarkRunner) maxLatency() int64 {
 	secs := l.maxLatencySeconds
 	if secs <= 0 {
 		secs = defaultMaxLatencySeconds
 	}
-	return secs * 1_000_000
+	return secs * int64(time.Second/l.LatencyUnit())
 }
 
 // initHistograms allocates the fixed phase histograms using the configured
 // max latency cap. Must be called after flag.Parse and before any worker
 // records into a histogram.
 func (l *BenchmarkRunner) initHistograms() {
-	cap := l.maxLatencyMicros()
+	cap := l.maxLatency()
 	l.setupWriteHistogram = hdrhistogram.New(1, cap, 3)
 	l.inst_setupWriteHistogram = hdrhistogram.New(1, cap, 3)
 	l.writeHistogram = hdrhistogram.New(1, cap, 3)
@@ -365,13 +578,23 @@ func GetBenchmarkRunnerWithBatchSize(batchSize uint) *BenchmarkRunner {
 	flag.StringVar(&loader.fileName, "input", "", "File name to read databuild from")
 	flag.Uint64Var(&loader.maxRPS, "max-rps", 0, "enable limiting the rate of queries per second, 0 = no limit. By default no limit is specified and the binaries will stress the DB up to the maximum. A normal \"modus operandi\" would be to initially stress the system ( no limit on RPS) and afterwards that we know the limit vary with lower rps configurations.")
 	flag.StringVar(&loader.JsonOutFile, "json-out-file", "", "Name of json output file to output benchmark results. If not set, will not print to json.")
+	flag.BoolVar(&loader.latencyIncludeErrors, "latency-include-errors", false, "Report OverallQuantiles and the summary latency percentiles over all commands, failed ones included. By default they cover successful commands only, and failed commands are reported separately (<key>Errors in OverallQuantiles).")
+	flag.BoolVar(&loader.perClientStats, "per-client-stats", false, "Record ops, errors, bytes and latency quantiles per worker and per connection, plus worker idle time, in the json-out-file WorkerStats and ConnectionStats. The summary flags workers and connections that deviate from the rest.")
+	flag.StringVar(&loader.hdrLogFile, "hdr-log-file", "", "Name of a file to write the latencies to in HdrHistogram interval log format, one interval per reporting period, tagged per label and per label and query id. Values are in the --latency-unit. If not set, will not write it.")
 	flag.StringVar(&loader.Metadata, "metadata-string", "", "Metadata string to add to json-out-file. If -json-out-file is not set, will not use this option.")
 	flag.UintVar(&loader.maxTokenSizeMB, "max-token-size-mb", 1, "Maximum size of token to read from input file in MB. Minimum is 1MB.")
 	flag.UintVar(&loader.batchSize, "batch-size", batchSize, "Number of items to batch together per worker channel before dispatch.")
+	flag.StringVar(&loader.percentiles, "percentiles", defaultPercentiles, "Comma separated latency percentiles reported in OverallQuantiles, the TimeSeries datapoints and the summary (e.g. 50,90,99,99.9,99.99,99.999). Each is keyed q<digits>, e.g. 99.9 -> q999, as recorded in the json-out-file Percentiles.")
+	flag.UintVar(&loader.inputReaders, "input-readers", 1, "Number of parallel input readers. Above 1, the --input file is split into byte ranges at line boundaries, each read by its own scanner feeding its own subset of the workers (with its share of --requests, rewinding within its range).")
 	flag.Int64Var(&loader.maxLatencySeconds, "max-latency-seconds", defaultMaxLatencySeconds,
 		"Upper bound (in seconds) for HDR histogram latency tracking. Samples above this cap are dropped (not recorded). "+
 			"Default is 1s for backwards compatibility; raise (e.g. 60) when tail latencies exceed 1s, as on disk-backed RediSearch. "+
 			"Larger values use more memory per histogram (one fixed histogram per phase, plus one per query type and one per benchmark second).")
+	flag.StringVar(&loader.prometheusListen, "prometheus-listen", "", "Address (e.g. :9100) to serve live Prometheus metrics on /metrics while the benchmark runs: commands, errors, timeouts and TX/RX bytes counters, and latency summaries (with the --percentiles), per label and query id. If not set, no endpoint is served.")
+	flag.StringVar(&loader.reportFormat, "report-format", reportFormatText, "Format of the per reporting period progress output: text (human readable log lines), json (one JSON record per line) or csv (one row per period, after a header). The json and csv records hold the period's per-label rates, latency quantiles and errors, the errors and TX/RX bytes of all commands, and (json only) the per query id rates, quantiles and errors.")
+	flag.StringVar(&loader.reportFile, "report-file", "", "File to write the --report-format json or csv records to. If not set, they are written to stdout.")
+	flag.StringVar(&loader.csvOutDir, "csv-out-dir", "", "Directory to write the results to as flat CSV files at the end of the run: timeseries_<series>.csv per json-out-file TimeSeries entry (per label, per label and query id, errors, client and server), quantiles.csv with the OverallQuantiles and totals.csv with the Totals and OverallRates. If not set, will not write them.")
+	flag.StringVar(&loader.latencyUnitName, "latency-unit", "us", "Unit latencies are recorded in: us (microseconds) or ns (nanoseconds). ns resolves sub-microsecond differences, e.g. on loopback or with pipelining, at the cost of larger histograms. The json-out-file quantiles stay in milliseconds; the encoded histograms and the --hdr-log-file values are in this unit, as recorded in LatencyUnit.")
 	return loader
 }
 
@@ -379,9 +602,31 @@ func GetBenchmarkRunnerWithBatchSize(batchSize uint) *BenchmarkRunner {
 // and reads those to run the benchmark benchmark
 func (l *BenchmarkRunner) RunBenchmark(b Benchmark, workQueues uint) {
 	l.br = l.GetBufferedReader()
+	if l.latencyUnitName != "" {
+		unit, ok := latencyUnits[l.latencyUnitName]
+		if !ok {
+			log.Fatalf("invalid --latency-unit %q: must be us or ns", l.latencyUnitName)
+		}
+		l.latencyUnit = unit
+	}
 	l.initHistograms()
+	if l.percentiles != "" {
+		quantiles, err := parsePercentiles(l.percentiles)
+		if err != nil {
+			log.Fatalf("invalid --percentiles: %v", err)
+		}
+		l.quantiles = quantiles
+	}
+	if l.prometheusListen != "" {
+		l.startPrometheus()
+	}
+	progress, err := newProgressWriter(l.reportFormat, l.reportFile)
+	if err != nil {
+		log.Fatalf("invalid --report-format %s: %v", l.reportFormat, err)
+	}
+	l.progress = progress
 
-	channels := l.createChannels(workQueues)
+	shards := l.createShards(workQueues)
 	// Launch all worker processes in background
 
 	var requestRate = Inf
@@ -395,26 +640,57 @@ func (l *BenchmarkRunner) RunBenchmark(b Benchmark, workQueues uint) {
 		log.Printf("Warning! You've specified both --duration %d and --requests %d limits. --duration %d takes precedence over --requests", l.Duration, l.limit, l.Duration)
 	}
 
+	if l.perClientStats {
+		l.workerStats = make([]*clientStats, l.workers)
+		for i := range l.workerStats {
+			l.workerStats[i] = newClientStats(l.maxLatency(), l.unitsPerMilli())
+		}
+		l.connectionStats = make(map[uint32]*clientStats)
+	}
+
 	var wg sync.WaitGroup
-	for i := 0; i < int(l.workers); i++ {
-		wg.Add(1)
-		go l.work(b, &wg, channels[i%len(channels)], i, rateLimiter, l.maxRPS != 0)
+	workerNum := 0
+	for _, shard := range shards {
+		for i := 0; i < int(shard.workers); i++ {
+			wg.Add(1)
+			go l.work(b, &wg, shard.channels[i%len(shard.channels)], workerNum, rateLimiter, l.maxRPS != 0)
+			workerNum++
+		}
 	}
 
 	// Start scan process - actual databuild read process
+	diagnostics, hasDiagnostics := b.(ServerDiagnostics)
+	if hasDiagnostics {
+		diagnostics.ResetServerDiagnostics()
+	}
+	l.serverStats = startServerStats(b, l.reportingPeriod)
+	l.runtime = newRuntimeTracker()
 	l.start = time.Now()
+	if l.hdrLogFile != "" {
+		var err error
+		l.hdrLog, err = newHdrLogWriter(l.hdrLogFile, l.start, l.LatencyUnit())
+		if err != nil {
+			log.Fatalf("cannot create --hdr-log-file %s: %v", l.hdrLogFile, err)
+		}
+	}
 
-	l.scan(b, channels, l.start)
+	l.scan(b, shards, l.start)
 
 	// After scan process completed (no more databuild to come) - begin shutdown process
 
 	// Close all communication channels to/from workers
-	for _, c := range channels {
-		c.close()
+	for _, shard := range shards {
+		for _, c := range shard.channels {
+			c.close()
+		}
 	}
 
 	// Wait for all workers to finish
 	wg.Wait()
+	l.testResult.QueryProfiles = stopQueryProfiler(b)
+	if hasDiagnostics {
+		l.testResult.ServerDiagnostics = diagnostics.GetServerDiagnosticsMap()
+	}
 
 	// Stop the periodic reporter before the final read-out so it no longer
 	// touches the histograms or the *Ts slices concurrently with GetTimeSeriesMap
@@ -440,19 +716,46 @@ func (l *BenchmarkRunner) RunBenchmark(b Benchmark, workQueues uint) {
 			l.histogramsMutex.Unlock()
 		}
 	}
+	if l.progress != nil {
+		l.progress.close()
+	}
 
 	l.end = time.Now()
+	l.runtime.finish()
+	if l.serverStats != nil {
+		l.serverStats.finish()
+	}
+	if l.hdrLog != nil && l.reportingPeriod.Nanoseconds() <= 0 {
+		// Without a reporter nothing was reset, so the interval histograms hold
+		// the whole run. Otherwise the reporter closed the log when stopping.
+		l.writeHdrLogIntervals(l.start, l.end.Sub(l.start))
+		l.closeHdrLog()
+	}
 	l.testResult.DBSpecificConfigs = b.GetConfigurationParametersMap()
 	l.testResult.Totals = l.GetTotalsMap()
 	l.testResult.MeasuredRatios = l.GetMeasuredRatiosMap()
 	l.testResult.OverallRates = l.GetOverallRatesMap()
 	l.testResult.TimeSeries = l.GetTimeSeriesMap()
 	l.testResult.OverallQuantiles = l.GetOverallQuantiles()
+	l.testResult.SteadyState = l.GetSteadyStateMap()
 	l.testResult.PerSecondEncodedHistograms = l.GetPerSecondEncodedHistogramsMap()
+	l.testResult.PerSecondEncodedLabelHistograms = l.GetPerSecondEncodedLabelHistogramsMap()
+	l.testResult.ConnectionCommandCounts = l.GetConnectionCommandCountsMap()
+	l.testResult.WorkerStats = l.GetWorkerStatsMap()
+	l.testResult.ConnectionStats = l.GetConnectionStatsMap()
+	l.testResult.ReplyStats = l.GetReplyStatsMap()
+	l.testResult.PipelineStats = l.GetPipelineStatsMap()
+	l.testResult.ClientRuntimeStats = l.GetClientRuntimeStatsMap()
+	l.testResult.ServerStats = l.GetServerStatsMap()
+	if !l.doLoad {
+		l.testResult.InputReadStats = l.GetInputReadStatsMap()
+	}
 	l.testResult.Limit = l.limit
 	l.testResult.Workers = l.workers
+	l.testResult.InputReaders = uint(len(shards))
 	l.testResult.MaxRps = l.maxRPS
 	l.summary()
+	l.stopPrometheus()
 }
 
 // GetBufferedReader returns the buffered Reader that should be used by the loader
@@ -510,31 +813,40 @@ func (l *BenchmarkRunner) GetResetReaderFunc(b Benchmark) func() (*bufio.Reader,
 // Number of workers may be different from number of channels, thus we may have
 // multiple workers per channel
 func (l *BenchmarkRunner) createChannels(workQueues uint) []*duplexChannel {
+	return l.createChannelsFor(workQueues, l.workers)
+}
+
+// createChannelsFor is createChannels for a given number of workers, e.g. the
+// subset of workers fed by one input shard.
+func (l *BenchmarkRunner) createChannelsFor(workQueues uint, workers uint) []*duplexChannel {
 	// Result - channels to be created
 	channels := []*duplexChannel{}
 
 	// How many work queues should be created?
 	workQueuesToCreate := workQueues
 	if workQueues == WorkerPerQueue {
-		workQueuesToCreate = l.workers
-	} else if workQueues > l.workers {
-		panic(fmt.Sprintf("cannot have more work queues (%d) than workers (%d)", workQueues, l.workers))
+		workQueuesToCreate = workers
+	} else if workQueues > workers {
+		panic(fmt.Sprintf("cannot have more work queues (%d) than workers (%d)", workQueues, workers))
 	}
 
 	// How many workers would be served by each queue?
-	workersPerQueue := int(math.Ceil(float64(l.workers) / float64(workQueuesToCreate)))
+	workersPerQueue := int(math.Ceil(float64(workers) / float64(workQueuesToCreate)))
 
-	// Create duplex communication channels
+	// Create duplex communication channels. Acknowledges from every channel go
+	// to one shared channel, sized so a worker never blocks acknowledging: the
+	// scanner keeps at most ~3 batches per queue slot outstanding (see dispatcher).
+	toScanner := make(chan int, int(workQueuesToCreate)*workersPerQueue*3+int(workQueuesToCreate))
 	for i := uint(0); i < workQueuesToCreate; i++ {
-		channels = append(channels, newDuplexChannel(workersPerQueue))
+		channels = append(channels, newDuplexChannel(int(i), workersPerQueue, toScanner))
 	}
 
 	return channels
 }
 
 // scan launches any needed reporting mechanism and proceeds to scan input databuild
-// to distribute to workers
-func (l *BenchmarkRunner) scan(b Benchmark, channels []*duplexChannel, start time.Time) uint64 {
+// to distribute to workers, with one scanner per input shard
+func (l *BenchmarkRunner) scan(b Benchmark, shards []*inputShard, start time.Time) uint64 {
 	if l.reportingPeriod.Nanoseconds() > 0 {
 		l.stopReport = make(chan struct{})
 		l.reportDone = make(chan struct{})
@@ -547,8 +859,16 @@ func (l *BenchmarkRunner) scan(b Benchmark, channels []*duplexChannel, start tim
 		defer cancel()
 	}
 
+	if !shards[0].whole {
+		return l.scanShards(ctx, b, shards)
+	}
+
+	channels := shards[0].channels
 	resetFn := l.GetResetReaderFunc(b)
-	return scanWithTimeout(ctx, channels, l.batchSize, l.limit, l.Duration, l.br, b.GetCmdDecoder(l.br, l.maxTokenSizeMB), b.GetBatchFactory(), b.GetCommandIndexer(uint(len(channels))), resetFn)
+	itemsRead, stall := scanWithTimeout(ctx, channels, l.batchSize, l.limit, l.Duration, l.br, b.GetCmdDecoder(l.br, l.maxTokenSizeMB), b.GetBatchFactory(), b.GetCommandIndexer(uint(len(channels))), resetFn)
+	l.scanTime = time.Since(start)
+	l.scanStall = stall
+	return itemsRead
 }
 
 // recordCmdStat folds one command's measurement into the aggregate counters and
@@ -573,21 +893,61 @@ func (l *BenchmarkRunner) recordCmdStat(cmdStat CmdStat) {
 
 	l.detailedMapHistogramsMutex.Lock()
 	if _, exist := l.detailedMapHistograms[groupAndQuery]; !exist {
-		l.detailedMapHistograms[groupAndQuery] = hdrhistogram.New(1, l.maxLatencyMicros(), 3)
+		l.detailedMapHistograms[groupAndQuery] = hdrhistogram.New(1, l.maxLatency(), 3)
 	}
 	l.detailedMapHistograms[groupAndQuery].RecordValue(latency)
+	if _, exist := l.inst_detailedMapHistograms[groupAndQuery]; !exist {
+		l.inst_detailedMapHistograms[groupAndQuery] = hdrhistogram.New(1, l.maxLatency(), 3)
+	}
+	l.inst_detailedMapHistograms[groupAndQuery].RecordValue(latency)
+	if cmdStat.Error() {
+		l.recordErrorClass(groupAndQuery, cmdStat.ErrorClass())
+	}
+	l.recordOutcome(labelStr, groupAndQuery, latency, cmdStat.Error())
+	l.recordReply(groupAndQuery, cmdStat)
+	if l.promCounters != nil {
+		l.recordPromCounters(labelStr, groupAndQuery, cmdStat)
+	}
 	l.detailedMapHistogramsMutex.Unlock()
 
 	ts := cmdStat.StartTs()
 	l.perSecondHistogramsMutex.Lock()
 	if _, exist := l.perSecondHistograms[ts]; !exist {
-		l.perSecondHistograms[ts] = hdrhistogram.New(1, l.maxLatencyMicros(), 3)
+		l.perSecondHistograms[ts] = hdrhistogram.New(1, l.maxLatency(), 3)
 	}
 	l.perSecondHistograms[ts].RecordValue(latency)
+	if labelKey, ok := labelQuantileKeys[labelStr]; ok {
+		if l.perSecondLabelHistograms == nil {
+			l.perSecondLabelHistograms = make(map[string]map[uint64]*hdrhistogram.Histogram)
+		}
+		if _, exist := l.perSecondLabelHistograms[labelKey]; !exist {
+			l.perSecondLabelHistograms[labelKey] = make(map[uint64]*hdrhistogram.Histogram)
+		}
+		if _, exist := l.perSecondLabelHistograms[labelKey][ts]; !exist {
+			l.perSecondLabelHistograms[labelKey][ts] = hdrhistogram.New(1, l.maxLatency(), 3)
+		}
+		l.perSecondLabelHistograms[labelKey][ts].RecordValue(latency)
+	}
+	if cmdStat.Error() {
+		l.recordSecondError(ts, labelQuantileKeys[labelStr], latency)
+	}
 	l.perSecondHistogramsMutex.Unlock()
 
 	l.histogramsMutex.Lock()
 	defer l.histogramsMutex.Unlock()
+	if l.connectionOps == nil {
+		l.connectionOps = make(map[uint32]uint64)
+	}
+	l.connectionOps[cmdStat.ConnId()]++
+	if l.connectionStats != nil {
+		c, exist := l.connectionStats[cmdStat.ConnId()]
+		if !exist {
+			c = newClientStats(l.maxLatency(), l.unitsPerMilli())
+			l.connectionStats[cmdStat.ConnId()] = c
+		}
+		c.record(cmdStat)
+	}
+	l.recordPipeline(labelStr, cmdStat)
 	_ = l.totalHistogram.RecordValue(latency)
 	_ = l.inst_totalHistogram.RecordValue(latency)
 	switch labelStr {
@@ -619,15 +979,36 @@ func (l *BenchmarkRunner) work(b Benchmark, wg *sync.WaitGroup, c *duplexChannel
 	proc := b.GetProcessor()
 	proc.Init(workerNum, l.doLoad, int(l.workers))
 
+	var workerStats *clientStats
+	if l.workerStats != nil {
+		workerStats = l.workerStats[workerNum]
+	}
+
 	// Process batches coming from duplexChannel.toWorker queue
 	// and send ACKs into duplexChannel.toScanner queue
+	waitStart := time.Now()
 	for b := range c.toWorker {
+		if workerStats != nil {
+			workerStats.idle += time.Since(waitStart)
+		}
 		stats := proc.ProcessBatch(b, l.doLoad, rateLimiter, useRateLimiter)
 		cmdStats := stats.CmdStats()
 		for pos := 0; pos < len(cmdStats); pos++ {
 			l.recordCmdStat(cmdStats[pos])
+			if workerStats != nil {
+				workerStats.record(cmdStats[pos])
+			}
+		}
+		if stats.InputRows() > 0 {
+			atomic.AddUint64(&l.inputRows, stats.InputRows())
+			atomic.AddUint64(&l.inputBytes, stats.InputBytes())
+			atomic.AddUint64(&l.parseNanos, uint64(stats.ParseTime().Nanoseconds()))
 		}
 		c.sendToScanner()
+		waitStart = time.Now()
+	}
+	if workerStats != nil {
+		workerStats.idle += time.Since(waitStart)
 	}
 
 	// Close proc if necessary
@@ -668,8 +1049,21 @@ func (l *BenchmarkRunner) summary() {
 	l.testResult.DurationMillis = took.Milliseconds()
 	l.testResult.Metadata = l.Metadata
 	l.testResult.ResultFormatVersion = CurrentResultFormatVersion
+	l.testResult.LatencyUnit = l.latencyUnitString()
+	l.testResult.QuantilesUnit = "ms"
+	l.testResult.Percentiles = map[string]float64{}
+	for _, q := range l.reportedQuantiles() {
+		l.testResult.Percentiles[q.key] = q.percentile
+	}
 
 	log.Printf("\nSummary:\n")
+	if !l.doLoad {
+		// No command was sent: the read-speed report replaces the (all-zero)
+		// command stats.
+		l.inputReadSummary()
+		l.writeJsonOutFile()
+		return
+	}
 	totalSuccessful := totalOps - int64(totalErrors)
 	log.Printf("Issued %d Commands (%d successful, %d failed) in %0.3fsec with %d workers\n", totalOps, totalSuccessful, totalErrors, took.Seconds(), l.workers)
 	log.Printf("\tOverall stats:\n\t"+
@@ -681,22 +1075,30 @@ func (l *BenchmarkRunner) summary() {
 		"- Updates %0.0f ops/sec\t\t\tq50 lat %0.3f ms\n\t"+
 		"- Deletes %0.0f ops/sec\t\t\tq50 lat %0.3f ms\n",
 		overallOpsRate,
-		float64(l.totalHistogram.ValueAtQuantile(50.0))/10e2,
+		l.summaryQ50(allCommandsKey, l.totalHistogram),
 		setupWriteRate,
-		float64(l.setupWriteHistogram.ValueAtQuantile(50.0))/10e2,
+		l.summaryQ50("setupWrite", l.setupWriteHistogram),
 		writeRate,
-		float64(l.writeHistogram.ValueAtQuantile(50.0))/10e2,
+		l.summaryQ50("write", l.writeHistogram),
 		readRate,
-		float64(l.readHistogram.ValueAtQuantile(50.0))/10e2,
+		l.summaryQ50("read", l.readHistogram),
 		readCursorRate,
-		float64(l.readCursorHistogram.ValueAtQuantile(50.0))/10e2,
+		l.summaryQ50("readCursor", l.readCursorHistogram),
 		updateRate,
-		float64(l.updateHistogram.ValueAtQuantile(50.0))/10e2,
+		l.summaryQ50("update", l.updateHistogram),
 		deleteRate,
-		float64(l.deleteHistogram.ValueAtQuantile(50.0))/10e2,
+		l.summaryQ50("delete", l.deleteHistogram),
 	)
+	l.percentilesSummary()
+	l.steadyStateSummary()
+	l.pipelineSummary()
 	log.Printf("\tOverall TX Byte Rate: %sB/sec\n", txByteRateStr)
 	log.Printf("\tOverall RX Byte Rate: %sB/sec\n", rxByteRateStr)
+	l.connectionsSummary()
+	l.clientStatsSummary()
+	l.replyStatsSummary()
+	l.clientRuntimeSummary()
+	l.serverStatsSummary()
 
 	// Display error and timeout statistics
 	log.Printf("\n\tError Statistics:\n")
@@ -706,12 +1108,19 @@ func (l *BenchmarkRunner) summary() {
 
 	}
 	log.Printf("\t- Total Errors: %d (%.2f%%)\n", totalErrors, errorRate)
+	l.errorClassesSummary(totalOps)
 	timeoutRate := 0.0
 	if totalTimeouts > 0 {
 		timeoutRate = (float64(totalTimeouts) / float64(totalOps)) * 100.0
 	}
 	log.Printf("\t- Total Timeouts: %d (%.2f%%)\n", totalTimeouts, timeoutRate)
 
+	l.writeJsonOutFile()
+	l.writeCsvOutDir()
+}
+
+// writeJsonOutFile writes the test result to --json-out-file, if set.
+func (l *BenchmarkRunner) writeJsonOutFile() {
 	if strings.Compare(l.JsonOutFile, "") != 0 {
 
 		file, err := json.MarshalIndent(l.testResult, "", " ")
@@ -724,7 +1133,88 @@ func (l *BenchmarkRunner) summary() {
 			log.Fatal(err)
 		}
 	}
+}
+
+// percentilesSummary prints the --percentiles latencies of every command
+// type that recorded at least one command, plus all commands combined.
+func (l *BenchmarkRunner) percentilesSummary() {
+	rows := []struct {
+		name string
+		key  string
+		hist *hdrhistogram.Histogram
+	}{
+		{"Total", allCommandsKey, l.totalHistogram},
+		{"Setup Writes", "setupWrite", l.setupWriteHistogram},
+		{"Writes", "write", l.writeHistogram},
+		{"Reads", "read", l.readHistogram},
+		{"Cursor Reads", "readCursor", l.readCursorHistogram},
+		{"Updates", "update", l.updateHistogram},
+		{"Deletes", "delete", l.deleteHistogram},
+	}
+	quantiles := l.reportedQuantiles()
+	var sb strings.Builder
+	title := "successful commands"
+	if l.latencyIncludeErrors {
+		title = "all commands"
+	}
+	fmt.Fprintf(&sb, "\tLatency percentiles (ms, %s):\n\t\t\t", title)
+	for _, q := range quantiles {
+		fmt.Fprintf(&sb, "\t%s", q.key)
+	}
+	writeRow := func(name string, hist *hdrhistogram.Histogram) {
+		_, mp := l.generateQuantileMap(hist)
+		fmt.Fprintf(&sb, "\n\t- %-14s", name)
+		for _, q := range quantiles {
+			fmt.Fprintf(&sb, "\t%0.3f", mp[q.key])
+		}
+	}
+	for _, row := range rows {
+		if row.hist.TotalCount() == 0 && row.name != "Total" {
+			continue
+		}
+		reported, errors := l.quantileHistograms(row.key, row.hist)
+		writeRow(row.name, reported)
+		if errors != nil {
+			writeRow(row.name+" errors", errors)
+		}
+	}
+	log.Printf("%s\n", sb.String())
+}
 
+// inputReadSummary prints the input read-speed report of a
+// --do-benchmark=false run, which sends no commands.
+func (l *BenchmarkRunner) inputReadSummary() {
+	stats := l.GetInputReadStatsMap()
+	log.Printf("Read %d rows (%s) without benchmarking in %0.3fsec with %d workers\n", stats["Rows"], bytefmt.ByteSize(stats["Bytes"].(uint64)), l.end.Sub(l.start).Seconds(), l.workers)
+	log.Printf("\tInput read stats:\n\t"+
+		"- Rows %0.0f rows/sec\n\t"+
+		"- Bytes %sB/sec\n\t"+
+		"- Decode time per row %0.3f us (scanner, excluding stalls)\n\t"+
+		"- Parse time per row %0.3f us (workers, incl. base64 decoding)\n\t"+
+		"- Scanner stalled on workers for %0.3fsec (%.2f%% of scan time)\n",
+		stats["RowsRate"],
+		stats["BytesRateStr"],
+		stats["DecodeTimePerRowMicros"],
+		stats["ParseTimePerRowMicros"],
+		stats["ScannerStallSeconds"],
+		stats["ScannerStallRatio"].(float64)*100.0,
+	)
+}
+
+// connectionsSummary prints how evenly commands were spread across the client
+// connections.
+func (l *BenchmarkRunner) connectionsSummary() {
+	if len(l.connectionOps) == 0 {
+		return
+	}
+	minOps, maxOps, sumOps := uint64(math.MaxUint64), uint64(0), uint64(0)
+	for _, ops := range l.connectionOps {
+		minOps = min(minOps, ops)
+		maxOps = max(maxOps, ops)
+		sumOps += ops
+	}
+	log.Printf("\tPer-connection commands: %d connections, min %d, max %d, mean %.0f\n",
+		len(l.connectionOps), minOps, maxOps, float64(sumOps)/float64(len(l.connectionOps)))
 }
 
 // report handles periodic reporting of loading stats
@@ -740,7 +1230,9 @@ func (l *BenchmarkRunner) report(period time.Duration, start time.Time) {
 	prevTxTotalBytes := uint64(0)
 	prevRxTotalBytes := uint64(0)
 
-	log.Printf("setup writes/sec\twrites/sec\tupdates/sec\treads/sec\tcursor reads/sec\tdeletes/sec\tcurrent ops/sec\ttotal ops\tTX BW/s\tRX BW/s\n")
+	if l.progress == nil {
+		log.Printf("setup writes/sec\twrites/sec\tupdates/sec\treads/sec\tcursor reads/sec\tdeletes/sec\tcurrent ops/sec\ttotal ops\tTX BW/s\tRX BW/s\n")
+	}
 	ticker := time.NewTicker(period)
 	defer ticker.Stop()
 	defer close(l.reportDone)
@@ -748,6 +1240,12 @@ func (l *BenchmarkRunner) report(period time.Duration, start time.Time) {
 		var now time.Time
 		select {
 		case <-l.stopReport:
+			if l.hdrLog != nil {
+				// the commands since the last tick have no timeseries datapoint,
+				// but the log should still add up to the whole run
+				l.writeHdrLogIntervals(prevTime, time.Since(prevTime))
+				l.closeHdrLog()
+			}
 			return
 		case now = <-ticker.C:
 		}
@@ -764,26 +1262,36 @@ func (l *BenchmarkRunner) report(period time.Duration, start time.Time) {
 		readCursorCount := l.readCursorHistogram.TotalCount()
 		updateCount := l.updateHistogram.TotalCount()
 		deleteCount := l.deleteHistogram.TotalCount()
-		setupWriteMedian := float64(l.setupWriteHistogram.ValueAtQuantile(50.0)) / 10e2
-		writeMedian := float64(l.writeHistogram.ValueAtQuantile(50.0)) / 10e2
-		updateMedian := float64(l.updateHistogram.ValueAtQuantile(50.0)) / 10e2
-		readMedian := float64(l.readHistogram.ValueAtQuantile(50.0)) / 10e2
-		readCursorMedian := float64(l.readCursorHistogram.ValueAtQuantile(50.0)) / 10e2
-		deleteMedian := float64(l.deleteHistogram.ValueAtQuantile(50.0)) / 10e2
-		totalMedian := float64(l.totalHistogram.ValueAtQuantile(50.0)) / 10e2
+		setupWriteMedian := l.latencyToMillis(l.setupWriteHistogram.ValueAtQuantile(50.0))
+		writeMedian := l.latencyToMillis(l.writeHistogram.ValueAtQuantile(50.0))
+		updateMedian := l.latencyToMillis(l.updateHistogram.ValueAtQuantile(50.0))
+		readMedian := l.latencyToMillis(l.readHistogram.ValueAtQuantile(50.0))
+		readCursorMedian := l.latencyToMillis(l.readCursorHistogram.ValueAtQuantile(50.0))
+		deleteMedian := l.latencyToMillis(l.deleteHistogram.ValueAtQuantile(50.0))
+		totalMedian := l.latencyToMillis(l.totalHistogram.ValueAtQuantile(50.0))
+		l.hdrLogLabelIntervals(prevTime, took)
 		l.setupWriteTs = l.addRateMetricsDatapoints(l.setupWriteTs, now, took, l.inst_setupWriteHistogram)
 		l.writeTs = l.addRateMetricsDatapoints(l.writeTs, now, took, l.inst_writeHistogram)
 		l.readTs = l.addRateMetricsDatapoints(l.readTs, now, took, l.inst_readHistogram)
 		l.readCursorTs = l.addRateMetricsDatapoints(l.readCursorTs, now, took, l.inst_readCursorHistogram)
 		l.updateTs = l.addRateMetricsDatapoints(l.updateTs, now, took, l.inst_updateHistogram)
 		l.deleteTs = l.addRateMetricsDatapoints(l.deleteTs, now, took, l.inst_deleteHistogram)
+		l.totalTs = l.addRateMetricsDatapoints(l.totalTs, now, took, l.inst_totalHistogram)
 		l.inst_setupWriteHistogram.Reset()
 		l.inst_writeHistogram.Reset()
 		l.inst_readHistogram.Reset()
 		l.inst_readCursorHistogram.Reset()
 		l.inst_updateHistogram.Reset()
 		l.inst_deleteHistogram.Reset()
+		l.inst_totalHistogram.Reset()
 		l.histogramsMutex.Unlock()
+		l.addDetailedDatapoints(now, took)
+		if l.runtime != nil {
+			l.runtime.sample()
+		}
+		if l.hdrLog != nil {
+			l.hdrLog.flush()
+		}
 
 		// Live total from the exact atomic counter so the progress line
 		// reconciles with the final TotalOps/overallOpsRate (per-label histogram
@@ -803,15 +1311,20 @@ func (l *BenchmarkRunner) report(period time.Duration, start time.Time) {
 		txByteRateStr := bytefmt.ByteSize(uint64(overallTxByteRate))
 		rxByteRateStr := bytefmt.ByteSize(uint64(overallRxByteRate))
 
-		log.Printf("%.0f (%.3f) \t%.0f (%.3f) \t%.0f (%.3f) \t%.0f (%.3f) \t%.0f (%.3f) \t%.0f (%.3f) \t %.0f (%.3f) \t%d \t %sB/s \t %sB/s\n",
-			setupWriteRate, setupWriteMedian,
-			writeRate, writeMedian,
-			updateRate, updateMedian,
-			readRate, readMedian,
-			readCursorRate, readCursorMedian,
-			deleteRate, deleteMedian,
-			CurrentOpsRate, totalMedian,
-			totalOps, txByteRateStr, rxByteRateStr)
+		if l.progress != nil {
+			record := l.progressRecord(now, start, took, totalOps, txTotalBytes-prevTxTotalBytes, rxTotalBytes-prevRxTotalBytes)
+			l.progress.write(record, l.reportedQuantiles())
+		} else {
+			log.Printf("%.0f (%.3f) \t%.0f (%.3f) \t%.0f (%.3f) \t%.0f (%.3f) \t%.0f (%.3f) \t%.0f (%.3f) \t %.0f (%.3f) \t%d \t %sB/s \t %sB/s\n",
+				setupWriteRate, setupWriteMedian,
+				writeRate, writeMedian,
+				updateRate, updateMedian,
+				readRate, readMedian,
+				readCursorRate, readCursorMedian,
+				deleteRate, deleteMedian,
+				CurrentOpsRate, totalMedian,
+				totalOps, txByteRateStr, rxByteRateStr)
+		}
 		prevSetupWriteCount = setupWriteCount
 		prevWriteCount = writeCount
 		prevReadCount = readCount
@@ -835,7 +1348,7 @@ func wrapNaN(input float64) (output float64) {
 }
 
 func (l *BenchmarkRunner) addRateMetricsDatapoints(datapoints []DataPoint, now time.Time, timeframe time.Duration, hist *hdrhistogram.Histogram) []DataPoint {
-	ops, mp := generateQuantileMap(hist)
+	ops, mp := l.generateQuantileMap(hist)
 	rate := 0.0
 	rate = float64(ops) / float64(timeframe.Seconds())
 	mp["rate"] = rate
@@ -845,47 +1358,116 @@ func (l *BenchmarkRunner) addRateMetricsDatapoints(datapoints []DataPoint, now t
 
 }
 
-func generateQuantileMap(hist *hdrhistogram.Histogram) (int64, map[string]float64) {
+// addDetailedDatapoints appends one datapoint per query id seen so far to
+// detailedTs and resets the per query id interval histograms. Query ids with no
+// commands in the period get a zero rate datapoint, so a stalled query shows up
+// as such rather than as a gap.
+func (l *BenchmarkRunner) addDetailedDatapoints(now time.Time, took time.Duration) {
+	l.detailedMapHistogramsMutex.Lock()
+	defer l.detailedMapHistogramsMutex.Unlock()
+	l.hdrLogQueryIntervals(now.Add(-took), took)
+	for k, hist := range l.inst_detailedMapHistograms {
+		l.detailedTs[k] = l.addRateMetricsDatapoints(l.detailedTs[k], now, took, hist)
+		hist.Reset()
+	}
+	l.addErrorDatapoints(now)
+}
+
+// hdrLogLabelIntervals adds the current interval of all commands and of every
+// label to --hdr-log-file. Callers hold histogramsMutex.
+func (l *BenchmarkRunner) hdrLogLabelIntervals(intervalStart time.Time, took time.Duration) {
+	if l.hdrLog == nil {
+		return
+	}
+	l.hdrLog.writeInterval("", intervalStart, took, l.inst_totalHistogram)
+	l.hdrLog.writeInterval("SETUP_WRITE", intervalStart, took, l.inst_setupWriteHistogram)
+	l.hdrLog.writeInterval("WRITE", intervalStart, took, l.inst_writeHistogram)
+	l.hdrLog.writeInterval("UPDATE", intervalStart, took, l.inst_updateHistogram)
+	l.hdrLog.writeInterval("READ", intervalStart, took, l.inst_readHistogram)
+	l.hdrLog.writeInterval("READ_CURSOR", intervalStart, took, l.inst_readCursorHistogram)
+	l.hdrLog.writeInterval("DELETE", intervalStart, took, l.inst_deleteHistogram)
+}
+
+// hdrLogQueryIntervals adds the current interval of every label and query id
+// to --hdr-log-file, in a stable order. Callers hold detailedMapHistogramsMutex.
+func (l *BenchmarkRunner) hdrLogQueryIntervals(intervalStart time.Time, took time.Duration) {
+	if l.hdrLog == nil {
+		return
+	}
+	keys := make([]string, 0, len(l.inst_detailedMapHistograms))
+	for k := range l.inst_detailedMapHistograms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		l.hdrLog.writeInterval(k, intervalStart, took, l.inst_detailedMapHistograms[k])
+	}
+}
+
+func (l *BenchmarkRunner) closeHdrLog() {
+	if err := l.hdrLog.close(); err != nil {
+		log.Fatalf("cannot write --hdr-log-file %s: %v", l.hdrLogFile, err)
+	}
+}
+
+// writeHdrLogIntervals adds the interval histograms as they are to
+// --hdr-log-file, without resetting them or adding timeseries datapoints.
+func (l *BenchmarkRunner) writeHdrLogIntervals(intervalStart time.Time, took time.Duration) {
+	l.histogramsMutex.Lock()
+	l.hdrLogLabelIntervals(intervalStart, took)
+	l.histogramsMutex.Unlock()
+	l.detailedMapHistogramsMutex.Lock()
+	l.hdrLogQueryIntervals(intervalStart, took)
+	l.detailedMapHistogramsMutex.Unlock()
+}
+
+// reportedQuantiles returns the percentiles configured via --percentiles,
+// defaulting to defaultPercentiles.
+func (l *BenchmarkRunner) reportedQuantiles() []quantile {
+	if l.quantiles == nil {
+		return defaultQuantiles
+	}
+	return l.quantiles
+}
+
+func (l *BenchmarkRunner) generateQuantileMap(hist *hdrhistogram.Histogram) (int64, map[string]float64) {
 	ops := hist.TotalCount()
-	q0 := 0.0
-	q50 := 0.0
-	q95 := 0.0
-	q99 := 0.0
-	q999 := 0.0
-	q100 := 0.0
-	if ops > 0 {
-		q0 = float64(hist.ValueAtQuantile(0.0)) / 10e2
-		q50 = float64(hist.ValueAtQuantile(50.0)) / 10e2
-		q95 = float64(hist.ValueAtQuantile(95.0)) / 10e2
-		q99 = float64(hist.ValueAtQuantile(99.0)) / 10e2
-		q999 = float64(hist.ValueAtQuantile(99.90)) / 10e2
-		q100 = float64(hist.ValueAtQuantile(100.0)) / 10e2
-	}
-
-	mp := map[string]float64{"q0": q0, "q50": q50, "q95": q95, "q99": q99, "q999": q999, "q100": q100}
+	mp := map[string]float64{}
+	for _, q := range l.reportedQuantiles() {
+		value := 0.0
+		if ops > 0 {
+			value = l.latencyToMillis(hist.ValueAtQuantile(q.percentile))
+		}
+		mp[q.key] = value
+	}
 	return ops, mp
 }
 
+// GetOverallQuantiles returns the latency quantiles per label, per label and
+// query id and of all commands. They cover successful commands only unless
+// --latency-include-errors is set; failed commands get their own <key>Errors
+// entry when there were any.
 func (b *BenchmarkRunner) GetOverallQuantiles() map[string]interface{} {
 	configs := map[string]interface{}{}
-	_, setupWrite := generateQuantileMap(b.setupWriteHistogram)
-	configs["setupWrite"] = setupWrite
-	_, write := generateQuantileMap(b.writeHistogram)
-	configs["write"] = write
-	_, read := generateQuantileMap(b.readHistogram)
-	configs["read"] = read
-	_, readCursor := generateQuantileMap(b.readCursorHistogram)
-	configs["readCursor"] = readCursor
-	_, update := generateQuantileMap(b.updateHistogram)
-	configs["update"] = update
-	_, delete := generateQuantileMap(b.deleteHistogram)
-	configs["delete"] = delete
-	_, all := generateQuantileMap(b.totalHistogram)
-	configs["allCommands"] = all
-
+	histograms := map[string]*hdrhistogram.Histogram{
+		"setupWrite":   b.setupWriteHistogram,
+		"write":        b.writeHistogram,
+		"read":         b.readHistogram,
+		"readCursor":   b.readCursorHistogram,
+		"update":       b.updateHistogram,
+		"delete":       b.deleteHistogram,
+		allCommandsKey: b.totalHistogram,
+	}
 	for k, hist := range b.detailedMapHistograms {
-		_, quantilesMap := generateQuantileMap(hist)
-		configs[k] = quantilesMap
+		histograms[k] = hist
+	}
+
+	for k, hist := range histograms {
+		reported, errors := b.quantileHistograms(k, hist)
+		_, configs[k] = b.generateQuantileMap(reported)
+		if errors != nil {
+			_, configs[k+"Errors"] = b.generateQuantileMap(errors)
+		}
 	}
 
 	return configs
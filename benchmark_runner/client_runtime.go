@@ -0,0 +1,156 @@
+package benchmark_runner
+
+import (
+	"log"
+	"runtime"
+	"time"
+)
+
+// clientCPUSaturation is the share of the client's usable CPUs (GOMAXPROCS)
+// above which the summary warns that the run may be client-bound.
+const clientCPUSaturation = 0.9
+
+// runtimeSample is a snapshot of the benchmark client's own resource usage.
+type runtimeSample struct {
+	at         time.Time
+	cpu        time.Duration
+	cpuOk      bool
+	goroutines int
+	heapAlloc  uint64
+	heapSys    uint64
+	numGC      uint32
+	pauseTotal time.Duration
+	// maxPause is the longest GC pause since the previous sample
+	maxPause time.Duration
+}
+
+// sampleRuntime snapshots the client's CPU time, goroutines, heap and GC
+// counters. prevNumGC is the GC count of the previous sample, used to find the
+// longest pause since then in the MemStats pause ring buffer.
+func sampleRuntime(prevNumGC uint32) runtimeSample {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	cpu, cpuOk := processCPUTime()
+	s := runtimeSample{
+		at:         time.Now(),
+		cpu:        cpu,
+		cpuOk:      cpuOk,
+		goroutines: runtime.NumGoroutine(),
+		heapAlloc:  ms.HeapAlloc,
+		heapSys:    ms.HeapSys,
+		numGC:      ms.NumGC,
+		pauseTotal: time.Duration(ms.PauseTotalNs),
+	}
+	// PauseNs holds the last 256 pauses, the most recent at (NumGC+255)%256
+	for gc := ms.NumGC; gc > prevNumGC && ms.NumGC-gc < uint32(len(ms.PauseNs)); gc-- {
+		s.maxPause = max(s.maxPause, time.Duration(ms.PauseNs[(gc+255)%256]))
+	}
+	return s
+}
+
+// cpuUsage returns the CPU time used between prev and s as a fraction of the
+// CPU time GOMAXPROCS could use over the same wall time.
+func (s runtimeSample) cpuUsage(prev runtimeSample) float64 {
+	wall := s.at.Sub(prev.at)
+	if !s.cpuOk || !prev.cpuOk || wall <= 0 {
+		return 0
+	}
+	return float64(s.cpu-prev.cpu) / float64(wall) / float64(runtime.GOMAXPROCS(0))
+}
+
+// runtimeTracker turns successive samples into clientTs datapoints and keeps
+// the peaks reported in the summary. It is only used by its owner: the
+// reporter goroutine during the run, RunBenchmark at its start and end.
+type runtimeTracker struct {
+	start, last, end runtimeSample
+	datapoints       []DataPoint
+
+	peakCPU        float64
+	saturated      int
+	intervals      int
+	peakGoroutines int
+	peakHeapAlloc  uint64
+	maxPause       time.Duration
+}
+
+func newRuntimeTracker() *runtimeTracker {
+	s := sampleRuntime(0)
+	s.maxPause = 0
+	return &runtimeTracker{start: s, last: s, peakGoroutines: s.goroutines, peakHeapAlloc: s.heapAlloc}
+}
+
+// sample adds a clientTs datapoint covering the time since the last sample.
+func (t *runtimeTracker) sample() {
+	s := sampleRuntime(t.last.numGC)
+	cpu := s.cpuUsage(t.last)
+	datapoint := NewDataPoint(s.at.Unix())
+	datapoint.AddValue("cpuUsage", cpu)
+	datapoint.AddValue("cpuCores", cpu*float64(runtime.GOMAXPROCS(0)))
+	datapoint.AddValue("goroutines", float64(s.goroutines))
+	datapoint.AddValue("heapAllocMB", float64(s.heapAlloc)/1024/1024)
+	datapoint.AddValue("heapSysMB", float64(s.heapSys)/1024/1024)
+	datapoint.AddValue("gcCount", float64(s.numGC-t.last.numGC))
+	datapoint.AddValue("gcPauseMs", float64(s.pauseTotal-t.last.pauseTotal)/float64(time.Millisecond))
+	datapoint.AddValue("gcPauseMaxMs", float64(s.maxPause)/float64(time.Millisecond))
+	t.datapoints = append(t.datapoints, *datapoint)
+
+	t.intervals++
+	if cpu >= clientCPUSaturation {
+		t.saturated++
+	}
+	t.peakCPU = max(t.peakCPU, cpu)
+	t.track(s)
+}
+
+// finish takes the closing sample the run's totals are computed from.
+func (t *runtimeTracker) finish() {
+	t.end = sampleRuntime(t.last.numGC)
+	t.track(t.end)
+}
+
+func (t *runtimeTracker) track(s runtimeSample) {
+	t.peakGoroutines = max(t.peakGoroutines, s.goroutines)
+	t.peakHeapAlloc = max(t.peakHeapAlloc, s.heapAlloc)
+	t.maxPause = max(t.maxPause, s.maxPause)
+	t.last = s
+}
+
+// GetClientRuntimeStatsMap returns the client's resource usage over the run.
+func (l *BenchmarkRunner) GetClientRuntimeStatsMap() map[string]interface{} {
+	t := l.runtime
+	if t == nil {
+		return nil
+	}
+	configs := map[string]interface{}{}
+	configs["GOMAXPROCS"] = runtime.GOMAXPROCS(0)
+	configs["NumCPU"] = runtime.NumCPU()
+	configs["CPUUsage"] = t.end.cpuUsage(t.start)
+	configs["CPUSeconds"] = (t.end.cpu - t.start.cpu).Seconds()
+	configs["PeakIntervalCPUUsage"] = t.peakCPU
+	configs["SaturatedIntervals"] = t.saturated
+	configs["PeakGoroutines"] = t.peakGoroutines
+	configs["PeakHeapAllocMB"] = float64(t.peakHeapAlloc) / 1024 / 1024
+	configs["GCCount"] = t.end.numGC - t.start.numGC
+	configs["GCPauseTotalMs"] = float64(t.end.pauseTotal-t.start.pauseTotal) / float64(time.Millisecond)
+	configs["GCPauseMaxMs"] = float64(t.maxPause) / float64(time.Millisecond)
+	return configs
+}
+
+// clientRuntimeSummary prints the client's resource usage, warning when the
+// client itself was short of CPU.
+func (l *BenchmarkRunner) clientRuntimeSummary() {
+	t := l.runtime
+	if t == nil {
+		return
+	}
+	procs := runtime.GOMAXPROCS(0)
+	cpu := t.end.cpuUsage(t.start)
+	log.Printf("\tClient resources: CPU %.1f%% of %d CPUs (peak %.1f%%), peak %d goroutines, peak heap %.1fMB, %d GCs (%.3f ms total pause, %.3f ms max)\n",
+		cpu*100, procs, t.peakCPU*100, t.peakGoroutines, float64(t.peakHeapAlloc)/1024/1024,
+		t.end.numGC-t.start.numGC, float64(t.end.pauseTotal-t.start.pauseTotal)/float64(time.Millisecond), float64(t.maxPause)/float64(time.Millisecond))
+	if cpu >= clientCPUSaturation {
+		log.Printf("\tWarning! The benchmark client used %.1f%% of its %d CPUs: results are likely client-bound. Run more client instances or on a larger client host.\n", cpu*100, procs)
+	} else if t.saturated > 0 {
+		log.Printf("\tWarning! The benchmark client saturated its %d CPUs in %d of %d reporting periods.\n", procs, t.saturated, t.intervals)
+	}
+}
@@ -0,0 +1,69 @@
+package benchmark_runner
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRuntimeTrackerSamples(t *testing.T) {
+	tracker := newRuntimeTracker()
+
+	// burn some CPU and force a couple of collections between the samples
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for x := 0; time.Now().Before(deadline); x++ {
+		_ = x * x
+	}
+	runtime.GC()
+	runtime.GC()
+	tracker.sample()
+
+	if len(tracker.datapoints) != 1 {
+		t.Fatalf("datapoints = %d, want 1", len(tracker.datapoints))
+	}
+	values := tracker.datapoints[0].MultiValues
+	for _, k := range []string{"cpuUsage", "cpuCores", "goroutines", "heapAllocMB", "heapSysMB", "gcCount", "gcPauseMs", "gcPauseMaxMs"} {
+		if _, ok := values[k]; !ok {
+			t.Errorf("clientTs datapoint is missing %s: %v", k, values)
+		}
+	}
+	if values["gcCount"] < 2 {
+		t.Errorf("gcCount = %v, want at least the 2 forced collections", values["gcCount"])
+	}
+	if values["goroutines"] < 1 {
+		t.Errorf("goroutines = %v, want at least 1", values["goroutines"])
+	}
+	if _, ok := processCPUTime(); ok && values["cpuUsage"] <= 0 {
+		t.Errorf("cpuUsage = %v after busy looping, want > 0", values["cpuUsage"])
+	}
+
+	tracker.finish()
+	l := &BenchmarkRunner{runtime: tracker}
+	stats := l.GetClientRuntimeStatsMap()
+	if stats["GCCount"].(uint32) < 2 {
+		t.Errorf("GCCount = %v, want at least 2", stats["GCCount"])
+	}
+	if stats["SaturatedIntervals"].(int) > 1 {
+		t.Errorf("SaturatedIntervals = %v, want at most the single sampled interval", stats["SaturatedIntervals"])
+	}
+	if stats["PeakIntervalCPUUsage"].(float64) < values["cpuUsage"] {
+		t.Errorf("PeakIntervalCPUUsage = %v, below the sampled %v", stats["PeakIntervalCPUUsage"], values["cpuUsage"])
+	}
+}
+
+func TestRuntimeSampleCPUUsage(t *testing.T) {
+	procs := float64(runtime.GOMAXPROCS(0))
+	start := time.Now()
+	prev := runtimeSample{at: start, cpu: time.Second, cpuOk: true}
+	s := runtimeSample{at: start.Add(time.Second), cpu: 3 * time.Second, cpuOk: true}
+	if got, want := s.cpuUsage(prev), 2/procs; got != want {
+		t.Errorf("cpuUsage = %v, want %v", got, want)
+	}
+	s.cpuOk = false
+	if got := s.cpuUsage(prev); got != 0 {
+		t.Errorf("cpuUsage without CPU times = %v, want 0", got)
+	}
+	if got := prev.cpuUsage(prev); got != 0 {
+		t.Errorf("cpuUsage over no wall time = %v, want 0", got)
+	}
+}
@@ -0,0 +1,202 @@
+package benchmark_runner
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// How far, as a fraction of the median across all workers or connections, a
+// client's ops or q99 latency must be from the rest to be flagged in the
+// summary. Tail latency is noisier than throughput, hence the wider margin.
+const (
+	clientOpsDeviationThreshold = 0.5
+	clientQ99DeviationThreshold = 1.0
+)
+
+// clientStats holds the --per-client-stats breakdown of one worker or one
+// connection. Worker stats are only touched by their own worker goroutine;
+// connection stats, which workers may share, are guarded by histogramsMutex.
+type clientStats struct {
+	ops, errors, timeouts uint64
+	txBytes, rxBytes      uint64
+	histogram             *hdrhistogram.Histogram
+	unitsPerMilli         float64
+
+	// idle is the time a worker spent waiting for batches from the scanner;
+	// always 0 for connections
+	idle time.Duration
+}
+
+func newClientStats(maxLatency int64, unitsPerMilli float64) *clientStats {
+	return &clientStats{histogram: hdrhistogram.New(1, maxLatency, 3), unitsPerMilli: unitsPerMilli}
+}
+
+func (c *clientStats) record(cmdStat CmdStat) {
+	c.ops++
+	if cmdStat.Error() {
+		c.errors++
+	}
+	if cmdStat.TimedOut() {
+		c.timeouts++
+	}
+	c.txBytes += cmdStat.Tx()
+	c.rxBytes += cmdStat.Rx()
+	_ = c.histogram.RecordValue(int64(cmdStat.Latency()))
+}
+
+func (c *clientStats) q99() float64 {
+	return float64(c.histogram.ValueAtQuantile(99.0)) / c.unitsPerMilli
+}
+
+// clientOutliers returns, per client, a description of how its ops and q99
+// latency deviate from the median of all clients by more than the thresholds
+// above, or "" when they do not.
+func clientOutliers(clients []*clientStats) []string {
+	outliers := make([]string, len(clients))
+	if len(clients) < 2 {
+		return outliers
+	}
+	ops := make([]float64, len(clients))
+	q99s := make([]float64, len(clients))
+	for i, c := range clients {
+		ops[i] = float64(c.ops)
+		q99s[i] = c.q99()
+	}
+	medianOps, medianQ99 := median(ops), median(q99s)
+	for i := range clients {
+		var reasons []string
+		if d := deviation(ops[i], medianOps); math.Abs(d) > clientOpsDeviationThreshold {
+			reasons = append(reasons, fmt.Sprintf("ops %.0f (median %.0f, %+.0f%%)", ops[i], medianOps, d*100))
+		}
+		if d := deviation(q99s[i], medianQ99); math.Abs(d) > clientQ99DeviationThreshold {
+			reasons = append(reasons, fmt.Sprintf("q99 %.3f ms (median %.3f ms, %+.0f%%)", q99s[i], medianQ99, d*100))
+		}
+		outliers[i] = strings.Join(reasons, ", ")
+	}
+	return outliers
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// deviation returns (value - reference) / reference, or 0 when both are 0.
+func deviation(value, reference float64) float64 {
+	if reference == 0 {
+		if value == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (value - reference) / reference
+}
+
+func (l *BenchmarkRunner) clientStatsMap(c *clientStats, took time.Duration, outlier string) map[string]interface{} {
+	configs := map[string]interface{}{}
+	configs["Ops"] = c.ops
+	configs["Errors"] = c.errors
+	configs["Timeouts"] = c.timeouts
+	configs["TxBytes"] = c.txBytes
+	configs["RxBytes"] = c.rxBytes
+	configs["OpsRate"] = calculateRateMetrics(int64(c.ops), 0, took)
+	_, configs["Quantiles"] = l.generateQuantileMap(c.histogram)
+	configs["Outlier"] = outlier != ""
+	return configs
+}
+
+// GetWorkerStatsMap returns the --per-client-stats breakdown per worker number,
+// or nil when it was not enabled.
+func (l *BenchmarkRunner) GetWorkerStatsMap() map[int]interface{} {
+	if len(l.workerStats) == 0 {
+		return nil
+	}
+	took := l.end.Sub(l.start)
+	outliers := clientOutliers(l.workerStats)
+	configs := map[int]interface{}{}
+	for i, c := range l.workerStats {
+		mp := l.clientStatsMap(c, took, outliers[i])
+		mp["IdleSeconds"] = c.idle.Seconds()
+		mp["IdleRatio"] = wrapNaN(c.idle.Seconds() / took.Seconds())
+		configs[i] = mp
+	}
+	return configs
+}
+
+// GetConnectionStatsMap returns the --per-client-stats breakdown per client
+// connection id, or nil when it was not enabled.
+func (l *BenchmarkRunner) GetConnectionStatsMap() map[uint32]interface{} {
+	if len(l.connectionStats) == 0 {
+		return nil
+	}
+	took := l.end.Sub(l.start)
+	ids, clients := l.sortedConnectionStats()
+	outliers := clientOutliers(clients)
+	configs := map[uint32]interface{}{}
+	for i, id := range ids {
+		configs[id] = l.clientStatsMap(clients[i], took, outliers[i])
+	}
+	return configs
+}
+
+func (l *BenchmarkRunner) sortedConnectionStats() ([]uint32, []*clientStats) {
+	ids := make([]uint32, 0, len(l.connectionStats))
+	for id := range l.connectionStats {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	clients := make([]*clientStats, len(ids))
+	for i, id := range ids {
+		clients[i] = l.connectionStats[id]
+	}
+	return ids, clients
+}
+
+// clientStatsSummary prints the spread of ops and q99 latency across workers
+// and connections, and every client deviating from the median.
+func (l *BenchmarkRunner) clientStatsSummary() {
+	if len(l.workerStats) > 0 {
+		names := make([]string, len(l.workerStats))
+		for i := range l.workerStats {
+			names[i] = fmt.Sprintf("worker %d", i)
+		}
+		printClientStatsSummary("worker", names, l.workerStats)
+	}
+	if len(l.connectionStats) > 0 {
+		ids, clients := l.sortedConnectionStats()
+		names := make([]string, len(ids))
+		for i, id := range ids {
+			names[i] = fmt.Sprintf("connection %d", id)
+		}
+		printClientStatsSummary("connection", names, clients)
+	}
+}
+
+func printClientStatsSummary(kind string, names []string, clients []*clientStats) {
+	minOps, maxOps := uint64(math.MaxUint64), uint64(0)
+	minQ99, maxQ99 := math.MaxFloat64, 0.0
+	var errors uint64
+	for _, c := range clients {
+		minOps, maxOps = min(minOps, c.ops), max(maxOps, c.ops)
+		minQ99, maxQ99 = min(minQ99, c.q99()), max(maxQ99, c.q99())
+		errors += c.errors
+	}
+	log.Printf("\tPer-%s stats: %d %ss, ops min %d max %d, q99 min %.3f ms max %.3f ms, %d errors\n",
+		kind, len(clients), kind, minOps, maxOps, minQ99, maxQ99, errors)
+	for i, outlier := range clientOutliers(clients) {
+		if outlier != "" {
+			log.Printf("\t- Warning! %s deviates from the rest: %s\n", names[i], outlier)
+		}
+	}
+}
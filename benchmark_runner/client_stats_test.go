@@ -0,0 +1,71 @@
+package benchmark_runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func clientWith(ops int, latency uint64) *clientStats {
+	c := newClientStats(1000000, 1000)
+	for i := 0; i < ops; i++ {
+		c.record(*NewCmdStat([]byte("READ"), []byte("R1"), latency, i%10 == 0, false, 10, 20))
+	}
+	return c
+}
+
+func TestClientOutliers(t *testing.T) {
+	clients := []*clientStats{
+		clientWith(100, 1000),
+		clientWith(110, 1100),
+		clientWith(40, 1000),  // starved
+		clientWith(100, 5000), // slow
+		clientWith(95, 900),
+	}
+	outliers := clientOutliers(clients)
+	for i, want := range []string{"", "", "ops 40", "q99 5.", ""} {
+		if want == "" && outliers[i] != "" || !strings.HasPrefix(outliers[i], want) {
+			t.Errorf("client %d outlier = %q, want prefix %q", i, outliers[i], want)
+		}
+	}
+	if got := clientOutliers(clients[:1]); got[0] != "" {
+		t.Errorf("a single client cannot deviate, got %q", got[0])
+	}
+}
+
+func TestWorkerAndConnectionStatsMaps(t *testing.T) {
+	l := newTestRunner()
+	l.workerStats = []*clientStats{clientWith(10, 1000), clientWith(30, 1000)}
+	l.workerStats[0].idle = 500 * time.Millisecond
+	l.connectionStats = map[uint32]*clientStats{}
+	for i := 0; i < 20; i++ {
+		cs := NewCmdStat([]byte("WRITE"), []byte("W1"), 1000, false, false, 10, 20)
+		cs.SetConnId(uint32(i % 2))
+		l.recordCmdStat(*cs)
+	}
+	l.start = time.Unix(0, 0)
+	l.end = l.start.Add(time.Second)
+
+	workers := l.GetWorkerStatsMap()
+	w0 := workers[0].(map[string]interface{})
+	if w0["Ops"] != uint64(10) || w0["Errors"] != uint64(1) || w0["TxBytes"] != uint64(200) {
+		t.Errorf("worker 0 = %v", w0)
+	}
+	if w0["IdleRatio"] != 0.5 || w0["OpsRate"] != 10.0 {
+		t.Errorf("worker 0 idle ratio / rate = %v / %v, want 0.5 / 10", w0["IdleRatio"], w0["OpsRate"])
+	}
+	if q := w0["Quantiles"].(map[string]float64)["q50"]; q < 0.99 || q > 1.01 {
+		t.Errorf("worker 0 q50 = %v, want 1", q)
+	}
+
+	conns := l.GetConnectionStatsMap()
+	if len(conns) != 2 || conns[1].(map[string]interface{})["Ops"] != uint64(10) {
+		t.Errorf("connection stats = %v, want 10 ops on each of 2 connections", conns)
+	}
+
+	// disabled by default
+	l = newTestRunner()
+	if l.GetWorkerStatsMap() != nil || l.GetConnectionStatsMap() != nil {
+		t.Error("expected no per-client stats without --per-client-stats")
+	}
+}
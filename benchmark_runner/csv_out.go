@@ -0,0 +1,203 @@
+package benchmark_runner
+
+import (
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// csvFileNameUnsafe matches the characters of a series name not kept in its
+// --csv-out-dir file name.
+var csvFileNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// writeCsvOutDir writes the results to --csv-out-dir, if set, as flat CSV
+// files: timeseries_<series>.csv per TimeSeries entry (e.g.
+// timeseries_write.csv or timeseries_READ-R1.csv, see timeseriesFileNames),
+// with one row per datapoint and one column per value; quantiles.csv with one
+// row per OverallQuantiles key; and totals.csv with the Totals (error counts
+// flattened to ErrorsByClass.<class> and ErrorsByQueryId.<query>.<class>) and
+// OverallRates as name,value rows.
+func (l *BenchmarkRunner) writeCsvOutDir() {
+	if l.csvOutDir == "" {
+		return
+	}
+	if err := os.MkdirAll(l.csvOutDir, 0755); err != nil {
+		log.Fatalf("cannot create --csv-out-dir %s: %v", l.csvOutDir, err)
+	}
+	names := make([]string, 0, len(l.testResult.TimeSeries))
+	for name := range l.testResult.TimeSeries {
+		names = append(names, name)
+	}
+	fileNames, err := timeseriesFileNames(names)
+	if err != nil {
+		log.Fatalf("cannot write --csv-out-dir %s: %v", l.csvOutDir, err)
+	}
+	for name, series := range l.testResult.TimeSeries {
+		datapoints, ok := series.([]DataPoint)
+		if !ok {
+			continue
+		}
+		l.writeCsvFile(fileNames[name], timeseriesRows(datapoints))
+	}
+	l.writeCsvFile("quantiles.csv", l.quantileRows(l.testResult.OverallQuantiles))
+	l.writeCsvFile("totals.csv", totalsRows(l.testResult))
+	log.Printf("Wrote the results as CSV files to %s\n", l.csvOutDir)
+}
+
+// timeseriesFileNames returns the timeseries_<series>.csv file name of every
+// TimeSeries key. When replacing the unsafe characters of distinct series
+// makes their names collide, e.g. READ-R/1 and READ-R_1, the series whose
+// names were changed get a short hash of their actual name appended, e.g.
+// timeseries_READ-R_1_1a2b3c4d.csv.
+func timeseriesFileNames(keys []string) (map[string]string, error) {
+	sanitized := make(map[string]string, len(keys))
+	users := map[string]int{}
+	for _, key := range keys {
+		name := strings.TrimSuffix(key, "Ts")
+		sanitized[key] = csvFileNameUnsafe.ReplaceAllString(name, "_")
+		users[sanitized[key]]++
+	}
+	fileNames := make(map[string]string, len(keys))
+	seen := map[string]string{}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := sanitized[key]
+		if users[name] > 1 && name != strings.TrimSuffix(key, "Ts") {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(key))
+			name = fmt.Sprintf("%s_%08x", name, h.Sum32())
+		}
+		fileName := "timeseries_" + name + ".csv"
+		if other, exist := seen[fileName]; exist {
+			return nil, fmt.Errorf("series %q and %q would both be written to %s", other, key, fileName)
+		}
+		seen[fileName] = key
+		fileNames[key] = fileName
+	}
+	return fileNames, nil
+}
+
+func (l *BenchmarkRunner) writeCsvFile(name string, rows [][]string) {
+	fileName := filepath.Join(l.csvOutDir, name)
+	file, err := os.Create(fileName)
+	if err != nil {
+		log.Fatalf("cannot create %s: %v", fileName, err)
+	}
+	w := csv.NewWriter(file)
+	_ = w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		log.Fatalf("cannot write %s: %v", fileName, err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("cannot write %s: %v", fileName, err)
+	}
+}
+
+func formatCsvFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// timeseriesRows returns a timestamp column and a column per value of
+// datapoints, in name order; values missing from a datapoint are left empty.
+func timeseriesRows(datapoints []DataPoint) [][]string {
+	names := map[string]bool{}
+	for _, dp := range datapoints {
+		for k := range dp.MultiValues {
+			names[k] = true
+		}
+	}
+	columns := make([]string, 0, len(names))
+	for k := range names {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+	rows := [][]string{append([]string{"timestamp"}, columns...)}
+	for _, dp := range datapoints {
+		row := []string{strconv.FormatInt(dp.Timestamp, 10)}
+		for _, k := range columns {
+			if v, ok := dp.MultiValues[k]; ok {
+				row = append(row, formatCsvFloat(v))
+			} else {
+				row = append(row, "")
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// quantileRows returns a key column and a column per reported percentile,
+// with one row per OverallQuantiles key in name order.
+func (l *BenchmarkRunner) quantileRows(overallQuantiles map[string]interface{}) [][]string {
+	quantiles := l.reportedQuantiles()
+	header := []string{"key"}
+	for _, q := range quantiles {
+		header = append(header, q.key)
+	}
+	keys := make([]string, 0, len(overallQuantiles))
+	for k := range overallQuantiles {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := [][]string{header}
+	for _, k := range keys {
+		values, ok := overallQuantiles[k].(map[string]float64)
+		if !ok {
+			continue
+		}
+		row := []string{k}
+		for _, q := range quantiles {
+			row = append(row, formatCsvFloat(values[q.key]))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// totalsRows returns the name,value rows of the totals, rates and duration of
+// result, in name order.
+func totalsRows(result TestResult) [][]string {
+	values := map[string]string{
+		"DurationMillis": strconv.FormatInt(result.DurationMillis, 10),
+	}
+	for k, v := range result.Totals {
+		switch v := v.(type) {
+		case map[string]uint64:
+			for class, count := range v {
+				values[k+"."+class] = strconv.FormatUint(count, 10)
+			}
+		case map[string]map[string]uint64:
+			for query, classes := range v {
+				for class, count := range classes {
+					values[k+"."+query+"."+class] = strconv.FormatUint(count, 10)
+				}
+			}
+		default:
+			values[k] = fmt.Sprint(v)
+		}
+	}
+	for k, v := range result.OverallRates {
+		if f, ok := v.(float64); ok {
+			values[k] = formatCsvFloat(f)
+		} else {
+			values[k] = fmt.Sprint(v)
+		}
+	}
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	rows := [][]string{{"name", "value"}}
+	for _, k := range names {
+		rows = append(rows, []string{k, values[k]})
+	}
+	return rows
+}
@@ -0,0 +1,122 @@
+package benchmark_runner
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readCsv(t *testing.T, fileName string) [][]string {
+	t.Helper()
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestWriteCsvOutDir(t *testing.T) {
+	l := newTestRunner()
+	l.csvOutDir = filepath.Join(t.TempDir(), "csv")
+	for i := 0; i < 10; i++ {
+		cs := NewCmdStat([]byte("READ"), []byte("R/1"), 1000, i == 0, false, 100, 10)
+		cs.SetErrorClass("OOM")
+		l.recordCmdStat(*cs)
+	}
+	now := time.Unix(1700000001, 0)
+	l.readTs = l.addRateMetricsDatapoints(l.readTs, now, time.Second, l.inst_readHistogram)
+	l.addDetailedDatapoints(now, time.Second)
+	l.start, l.end = now.Add(-time.Second), now
+	l.testResult.DurationMillis = 1000
+	l.testResult.Totals = l.GetTotalsMap()
+	l.testResult.OverallRates = l.GetOverallRatesMap()
+	l.testResult.TimeSeries = l.GetTimeSeriesMap()
+	l.testResult.OverallQuantiles = l.GetOverallQuantiles()
+	l.writeCsvOutDir()
+
+	read := readCsv(t, filepath.Join(l.csvOutDir, "timeseries_read.csv"))
+	if len(read) != 2 || read[0][0] != "timestamp" || read[1][0] != "1700000001" {
+		t.Errorf("timeseries_read.csv = %v, want a header and one datapoint", read)
+	}
+	// unsafe file name characters are replaced
+	query := readCsv(t, filepath.Join(l.csvOutDir, "timeseries_READ-R_1.csv"))
+	columns := map[string]int{}
+	for i, name := range query[0] {
+		columns[name] = i
+	}
+	if got := query[1][columns["errors_OOM"]]; got != "1" {
+		t.Errorf("READ-R/1 errors_OOM = %s, want 1 in %v", got, query)
+	}
+	if got := query[1][columns["rate"]]; got != "10" {
+		t.Errorf("READ-R/1 rate = %s, want 10 in %v", got, query)
+	}
+
+	quantiles := readCsv(t, filepath.Join(l.csvOutDir, "quantiles.csv"))
+	if quantiles[0][0] != "key" || quantiles[0][2] != "q50" {
+		t.Errorf("quantiles.csv header = %v", quantiles[0])
+	}
+	found := false
+	for _, row := range quantiles[1:] {
+		if row[0] == "read" {
+			found = true
+			if row[2] != "1" {
+				t.Errorf("read q50 = %s ms, want 1", row[2])
+			}
+		}
+	}
+	if !found {
+		t.Errorf("quantiles.csv has no read row: %v", quantiles)
+	}
+
+	totals := map[string]string{}
+	for _, row := range readCsv(t, filepath.Join(l.csvOutDir, "totals.csv"))[1:] {
+		totals[row[0]] = row[1]
+	}
+	for name, want := range map[string]string{
+		"TotalOps":                     "10",
+		"Errors":                       "1",
+		"ErrorsByClass.OOM":            "1",
+		"ErrorsByQueryId.READ-R/1.OOM": "1",
+		"readRate":                     "10",
+		"DurationMillis":               "1000",
+	} {
+		if totals[name] != want {
+			t.Errorf("totals %s = %q, want %s", name, totals[name], want)
+		}
+	}
+}
+
+func TestTimeseriesFileNamesDisambiguatesCollisions(t *testing.T) {
+	names, err := timeseriesFileNames([]string{"readTs", "READ-R/1Ts", "READ-R_1Ts", "READ-R:1Ts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names["readTs"] != "timeseries_read.csv" || names["READ-R_1Ts"] != "timeseries_READ-R_1.csv" {
+		t.Errorf("names = %v, want the unchanged series to keep their file names", names)
+	}
+	seen := map[string]bool{}
+	for key, name := range names {
+		if seen[name] {
+			t.Errorf("%s shares its file name %s", key, name)
+		}
+		seen[name] = true
+	}
+	for _, key := range []string{"READ-R/1Ts", "READ-R:1Ts"} {
+		if !strings.HasPrefix(names[key], "timeseries_READ-R_1_") {
+			t.Errorf("%s file name = %s, want a hash suffix", key, names[key])
+		}
+	}
+	// without collisions nothing changes
+	names, _ = timeseriesFileNames([]string{"READ-R/1Ts"})
+	if names["READ-R/1Ts"] != "timeseries_READ-R_1.csv" {
+		t.Errorf("file name = %s, want timeseries_READ-R_1.csv", names["READ-R/1Ts"])
+	}
+}
@@ -2,18 +2,23 @@ package benchmark_runner
 
 // duplexChannel acts as a two-way channel for communicating from a scan routine
 // to a worker goroutine. The toWorker channel sends databuild to the worker for it
-// to process and the toScan channel allows the worker to acknowledge completion.
+// to process and the toScanner channel allows the worker to acknowledge completion.
 // Using this we can accomplish better flow control between the scanner and workers.
+// toScanner is shared by all the duplexChannels of a scan: an acknowledge carries
+// the index of the duplexChannel it came from.
 type duplexChannel struct {
+	idx       int
 	toWorker  chan Batch
-	toScanner chan bool
+	toScanner chan int
 }
 
-// newDuplexChannel returns a duplexChannel with specified buffer sizes
-func newDuplexChannel(queueLen int) *duplexChannel {
+// newDuplexChannel returns a duplexChannel with specified buffer size, acknowledging
+// on the shared toScanner channel
+func newDuplexChannel(idx int, queueLen int, toScanner chan int) *duplexChannel {
 	return &duplexChannel{
+		idx:       idx,
 		toWorker:  make(chan Batch, queueLen),
-		toScanner: make(chan bool, queueLen),
+		toScanner: toScanner,
 	}
 }
 
@@ -24,11 +29,12 @@ func (dc *duplexChannel) sendToWorker(b Batch) {
 
 // sendToScanner passes an acknowledge to the scanner from the worker
 func (dc *duplexChannel) sendToScanner() {
-	dc.toScanner <- true
+	dc.toScanner <- dc.idx
 }
 
-// close closes down the duplexChannel
+// close closes down the duplexChannel. The shared toScanner channel is left
+// open: other duplexChannels may still use it, and the scanner never ranges
+// over it.
 func (dc *duplexChannel) close() {
 	close(dc.toWorker)
-	close(dc.toScanner)
 }
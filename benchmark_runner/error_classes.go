@@ -0,0 +1,104 @@
+package benchmark_runner
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// UnclassifiedError is the error class of failed commands whose processor did
+// not set one via CmdStat.SetErrorClass.
+const UnclassifiedError = "OTHER"
+
+// errorCounts counts failed commands per error class.
+type errorCounts map[string]uint64
+
+// recordErrorClass counts a failed command of the given "LABEL-queryId" in
+// the overall, per query id and current interval error counts. Callers hold
+// detailedMapHistogramsMutex, which guards all of them.
+func (l *BenchmarkRunner) recordErrorClass(groupAndQuery, class string) {
+	if class == "" {
+		class = UnclassifiedError
+	}
+	if l.errorClasses == nil {
+		l.errorClasses = errorCounts{}
+		l.inst_errorClasses = errorCounts{}
+		l.detailedErrorClasses = map[string]errorCounts{}
+		l.inst_detailedErrorClasses = map[string]errorCounts{}
+	}
+	l.errorClasses[class]++
+	l.inst_errorClasses[class]++
+	if l.detailedErrorClasses[groupAndQuery] == nil {
+		l.detailedErrorClasses[groupAndQuery] = errorCounts{}
+		l.inst_detailedErrorClasses[groupAndQuery] = errorCounts{}
+	}
+	l.detailedErrorClasses[groupAndQuery][class]++
+	l.inst_detailedErrorClasses[groupAndQuery][class]++
+}
+
+// addErrorDatapoints appends to errorsTs the number of failed commands in the
+// period, in total and per error class seen so far, and adds the per class
+// counts of each query id to its latest detailedTs datapoint as errors_<class>.
+// It then resets the interval counts. Callers hold detailedMapHistogramsMutex.
+func (l *BenchmarkRunner) addErrorDatapoints(now time.Time) {
+	datapoint := NewDataPoint(now.Unix())
+	total := uint64(0)
+	for class := range l.errorClasses {
+		datapoint.AddValue(class, float64(l.inst_errorClasses[class]))
+		total += l.inst_errorClasses[class]
+		l.inst_errorClasses[class] = 0
+	}
+	datapoint.AddValue("total", float64(total))
+	l.errorsTs = append(l.errorsTs, *datapoint)
+
+	for k, classes := range l.detailedErrorClasses {
+		datapoints := l.detailedTs[k]
+		if len(datapoints) == 0 {
+			continue
+		}
+		latest := datapoints[len(datapoints)-1]
+		for class := range classes {
+			latest.AddValue("errors_"+class, float64(l.inst_detailedErrorClasses[k][class]))
+			l.inst_detailedErrorClasses[k][class] = 0
+		}
+	}
+}
+
+// GetErrorClassesMap returns the number of failed commands per error class.
+func (l *BenchmarkRunner) GetErrorClassesMap() map[string]uint64 {
+	configs := map[string]uint64{}
+	for class, count := range l.errorClasses {
+		configs[class] = count
+	}
+	return configs
+}
+
+// GetQueryIdErrorClassesMap returns the number of failed commands per
+// "LABEL-queryId" and error class.
+func (l *BenchmarkRunner) GetQueryIdErrorClassesMap() map[string]map[string]uint64 {
+	configs := map[string]map[string]uint64{}
+	for k, classes := range l.detailedErrorClasses {
+		configs[k] = map[string]uint64{}
+		for class, count := range classes {
+			configs[k][class] = count
+		}
+	}
+	return configs
+}
+
+// errorClassesSummary prints the failed commands per error class, most
+// frequent first.
+func (l *BenchmarkRunner) errorClassesSummary(totalOps int64) {
+	classes := make([]string, 0, len(l.errorClasses))
+	for class := range l.errorClasses {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		ci, cj := l.errorClasses[classes[i]], l.errorClasses[classes[j]]
+		return ci > cj || ci == cj && classes[i] < classes[j]
+	})
+	for _, class := range classes {
+		count := l.errorClasses[class]
+		log.Printf("\t  - %s: %d (%.2f%%)\n", class, count, float64(count)/float64(totalOps)*100.0)
+	}
+}
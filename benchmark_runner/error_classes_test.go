@@ -0,0 +1,55 @@
+package benchmark_runner
+
+import (
+	"testing"
+	"time"
+)
+
+func recordError(l *BenchmarkRunner, label, queryId, class string) {
+	cs := NewCmdStat([]byte(label), []byte(queryId), 100, true, class == "TIMEOUT", 0, 10)
+	cs.SetErrorClass(class)
+	l.recordCmdStat(*cs)
+}
+
+func TestErrorClassesTotalsAndTimeSeries(t *testing.T) {
+	l := newTestRunner()
+	if len(l.GetErrorClassesMap()) != 0 {
+		t.Fatal("expected no error classes before any error")
+	}
+	now := time.Unix(1000, 0)
+	recordError(l, "WRITE", "W1", "OOM")
+	recordError(l, "WRITE", "W1", "OOM")
+	recordError(l, "READ", "R1", "")
+	l.recordCmdStat(*NewCmdStat([]byte("READ"), []byte("R1"), 100, false, false, 10, 10))
+	l.addDetailedDatapoints(now, time.Second)
+	recordError(l, "READ", "R1", "TIMEOUT")
+	l.addDetailedDatapoints(now.Add(time.Second), time.Second)
+
+	byClass := l.GetErrorClassesMap()
+	if byClass["OOM"] != 2 || byClass[UnclassifiedError] != 1 || byClass["TIMEOUT"] != 1 || len(byClass) != 3 {
+		t.Errorf("ErrorsByClass = %v", byClass)
+	}
+	byQuery := l.GetQueryIdErrorClassesMap()
+	if byQuery["WRITE-W1"]["OOM"] != 2 || byQuery["READ-R1"]["TIMEOUT"] != 1 || byQuery["READ-R1"][UnclassifiedError] != 1 {
+		t.Errorf("ErrorsByQueryId = %v", byQuery)
+	}
+
+	ts := l.GetTimeSeriesMap()
+	errorsTs := ts["errorsTs"].([]DataPoint)
+	if len(errorsTs) != 2 {
+		t.Fatalf("errorsTs = %v, want 2 datapoints", errorsTs)
+	}
+	if v := errorsTs[0].MultiValues; v["total"] != 3 || v["OOM"] != 2 || v[UnclassifiedError] != 1 {
+		t.Errorf("first errorsTs datapoint = %v", v)
+	}
+	if v := errorsTs[1].MultiValues; v["total"] != 1 || v["OOM"] != 0 || v["TIMEOUT"] != 1 {
+		t.Errorf("second errorsTs datapoint = %v", v)
+	}
+	r1 := ts["READ-R1Ts"].([]DataPoint)
+	if r1[0].MultiValues["errors_"+UnclassifiedError] != 1 || r1[1].MultiValues["errors_TIMEOUT"] != 1 || r1[1].MultiValues["errors_"+UnclassifiedError] != 0 {
+		t.Errorf("READ-R1Ts error counts = %v, %v", r1[0].MultiValues, r1[1].MultiValues)
+	}
+	if _, ok := ts["WRITE-W1Ts"].([]DataPoint)[0].MultiValues["errors_OOM"]; !ok {
+		t.Error("WRITE-W1Ts is missing errors_OOM")
+	}
+}
@@ -0,0 +1,109 @@
+package benchmark_runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// hdrLogWriter writes --hdr-log-file in the HdrHistogram interval log format
+// (version 1.3), so HistogramLogProcessor and the other HdrHistogram tools can
+// consume the latencies directly. Every reporting period adds an untagged line
+// for all commands, plus one tagged line per command label (e.g. Tag=READ) and
+// per label and query id (e.g. Tag=READ-R3) that had commands in the period.
+//
+// Interval timestamps are seconds since the StartTime (and BaseTime) header. Histogram values
+// are recorded in the latency unit (microseconds, or nanoseconds with
+// --latency-unit ns), while the Interval_Max column is in milliseconds; pass
+// -outputValueUnitRatio 1000 (1000000 for ns) to HistogramLogProcessor for ms
+// output.
+//
+// hdrhistogram-go's own HistogramLogWriter is not used: it writes millisecond
+// timestamps where the format expects seconds and cannot scale the max column
+// for microsecond values.
+type hdrLogWriter struct {
+	file          *os.File
+	w             *bufio.Writer
+	start         time.Time
+	unitsPerMilli float64
+	err           error
+}
+
+func newHdrLogWriter(fileName string, start time.Time, unit time.Duration) (*hdrLogWriter, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	h := &hdrLogWriter{file: file, w: bufio.NewWriterSize(file, 1<<20), start: start, unitsPerMilli: float64(time.Millisecond / unit)}
+	unitName := "microseconds"
+	if unit == time.Nanosecond {
+		unitName = "nanoseconds"
+	}
+	startSecs := float64(start.UnixNano()) / 1e9
+	h.printf("#[Histogram log format version 1.3]\n")
+	h.printf("#[StartTime: %.3f (seconds since epoch), %s]\n", startSecs, start.Format(time.RFC1123))
+	h.printf("#[BaseTime: %.3f (seconds since epoch)]\n", startSecs)
+	h.printf("#Latency values in %s\n", unitName)
+	h.printf("\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n")
+	return h, h.err
+}
+
+func (h *hdrLogWriter) printf(format string, a ...interface{}) {
+	if h.err == nil {
+		_, h.err = fmt.Fprintf(h.w, format, a...)
+	}
+}
+
+// writeInterval adds the interval [intervalStart, intervalStart+length) of
+// hist, tagged with tag unless it is empty. Tagged intervals without commands
+// are skipped; the untagged one is always written so the log has no gaps.
+func (h *hdrLogWriter) writeInterval(tag string, intervalStart time.Time, length time.Duration, hist *hdrhistogram.Histogram) {
+	if tag != "" && hist.TotalCount() == 0 {
+		return
+	}
+	encoded, err := hist.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		if h.err == nil {
+			h.err = err
+		}
+		return
+	}
+	if tag != "" {
+		h.printf("Tag=%s,", hdrLogTag(tag))
+	}
+	h.printf("%.3f,%.3f,%.3f,%s\n", intervalStart.Sub(h.start).Seconds(), length.Seconds(), float64(hist.Max())/h.unitsPerMilli, encoded)
+}
+
+// flush writes the buffered intervals out to the file. It is kept apart from
+// writeInterval so callers can add intervals while holding the histogram locks
+// and do the file I/O after releasing them.
+func (h *hdrLogWriter) flush() error {
+	if h.err == nil {
+		h.err = h.w.Flush()
+	}
+	return h.err
+}
+
+func (h *hdrLogWriter) close() error {
+	err := h.flush()
+	if cerr := h.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// hdrLogTag replaces the characters the log format does not allow in a tag
+// (commas, spaces and line breaks), which may appear in query ids.
+func hdrLogTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, tag)
+}
@@ -0,0 +1,63 @@
+package benchmark_runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+)
+
+func TestHdrLogWriterIsReadableByHdrHistogram(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "latencies.hlog")
+	start := time.Unix(1700000000, 0)
+	h, err := newHdrLogWriter(fileName, start, time.Microsecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := hdrhistogram.New(1, 1000000, 3)
+	reads := hdrhistogram.New(1, 1000000, 3)
+	empty := hdrhistogram.New(1, 1000000, 3)
+	for i := int64(1); i <= 100; i++ {
+		all.RecordValue(i * 10)
+		if i%4 == 0 {
+			reads.RecordValue(i * 10)
+		}
+	}
+	h.writeInterval("", start, time.Second, all)
+	h.writeInterval("READ-R1,2", start, time.Second, reads)
+	h.writeInterval("DELETE", start, time.Second, empty)
+	h.writeInterval("", start.Add(time.Second), time.Second, empty)
+	if err := h.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := hdrhistogram.NewHistogramLogReader(f)
+	want := []struct {
+		tag     string
+		count   int64
+		startMs int64
+	}{
+		{"", 100, 1700000000000},
+		{"READ-R1_2", 25, 1700000000000},
+		{"", 0, 1700000001000},
+	}
+	for i, w := range want {
+		hist, err := r.NextIntervalHistogram()
+		if err != nil || hist == nil {
+			t.Fatalf("interval %d: %v, %v", i, hist, err)
+		}
+		if hist.Tag() != w.tag || hist.TotalCount() != w.count || hist.StartTimeMs() != w.startMs {
+			t.Errorf("interval %d = tag %q count %d start %d, want %+v", i, hist.Tag(), hist.TotalCount(), hist.StartTimeMs(), w)
+		}
+	}
+	if hist, err := r.NextIntervalHistogram(); hist != nil || err != nil {
+		t.Errorf("expected end of log, got %v, %v", hist, err)
+	}
+}
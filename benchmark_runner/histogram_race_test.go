@@ -15,6 +15,8 @@ func newTestRunner() *BenchmarkRunner {
 	l := &BenchmarkRunner{maxLatencySeconds: 1}
 	l.initHistograms()
 	l.detailedMapHistograms = make(map[string]*hdrhistogram.Histogram)
+	l.inst_detailedMapHistograms = make(map[string]*hdrhistogram.Histogram)
+	l.detailedTs = make(map[string][]DataPoint)
 	l.perSecondHistograms = make(map[uint64]*hdrhistogram.Histogram)
 	return l
 }
@@ -127,3 +129,91 @@ func TestReportConcurrentWithRecordIsRaceFree(t *testing.T) {
 		t.Fatalf("totalOps = %d, want %d", got, workers*perWorker)
 	}
 }
+
+func TestAddDetailedDatapointsPerQueryId(t *testing.T) {
+	l := newTestRunner()
+	record := func(label, queryId string, n int) {
+		for i := 0; i < n; i++ {
+			l.recordCmdStat(*NewCmdStat([]byte(label), []byte(queryId), 1000, false, false, 10, 20))
+		}
+	}
+	now := time.Unix(1000, 0)
+	record("READ", "R1", 10)
+	record("READ", "R3", 4)
+	l.addDetailedDatapoints(now, time.Second)
+	record("READ", "R1", 6)
+	l.addDetailedDatapoints(now.Add(time.Second), time.Second)
+
+	ts := l.GetTimeSeriesMap()
+	r1, ok := ts["READ-R1Ts"].([]DataPoint)
+	if !ok || len(r1) != 2 {
+		t.Fatalf("READ-R1Ts = %v, want 2 datapoints", ts["READ-R1Ts"])
+	}
+	if r1[0].MultiValues["rate"] != 10 || r1[1].MultiValues["rate"] != 6 {
+		t.Errorf("READ-R1Ts rates = %v, %v, want 10, 6", r1[0].MultiValues["rate"], r1[1].MultiValues["rate"])
+	}
+	if q := r1[1].MultiValues["q50"]; q < 0.99 || q > 1.01 {
+		t.Errorf("READ-R1Ts q50 = %v ms, want 1", q)
+	}
+	r3 := ts["READ-R3Ts"].([]DataPoint)
+	if len(r3) != 2 || r3[0].MultiValues["rate"] != 4 || r3[1].MultiValues["rate"] != 0 {
+		t.Errorf("READ-R3Ts = %v, want rates 4 then 0", r3)
+	}
+	// the interval histograms are per period; the overall ones keep everything
+	if got := l.detailedMapHistograms["READ-R1"].TotalCount(); got != 16 {
+		t.Errorf("overall READ-R1 count = %d, want 16", got)
+	}
+}
+
+func TestAllCommandsTsAndPerSecondLabelHistograms(t *testing.T) {
+	l := newTestRunner()
+	stat := NewStat()
+	for i := 0; i < 6; i++ {
+		stat.AddEntry([]byte("WRITE"), []byte("W1"), 1000, 500, false, false, 0, 10)
+	}
+	for i := 0; i < 4; i++ {
+		stat.AddEntry([]byte("READ"), []byte("R1"), 1001, 2000, false, false, 10, 10)
+	}
+	for _, cmdStat := range stat.CmdStats() {
+		l.recordCmdStat(cmdStat)
+	}
+
+	l.stopReport = make(chan struct{})
+	l.reportDone = make(chan struct{})
+	go l.report(5*time.Millisecond, time.Now())
+	time.Sleep(20 * time.Millisecond)
+	close(l.stopReport)
+	<-l.reportDone
+
+	ts := l.GetTimeSeriesMap()
+	all, ok := ts["allCommandsTs"].([]DataPoint)
+	if !ok || len(all) == 0 {
+		t.Fatalf("allCommandsTs = %v, want datapoints", ts["allCommandsTs"])
+	}
+	writes := ts["writeTs"].([]DataPoint)
+	reads := ts["readTs"].([]DataPoint)
+	for i := range all {
+		sum := writes[i].MultiValues["rate"] + reads[i].MultiValues["rate"]
+		if diff := all[i].MultiValues["rate"] - sum; diff > 1e-6*sum || diff < -1e-6*sum {
+			t.Errorf("allCommandsTs[%d] rate %v, want writes %v + reads %v", i,
+				all[i].MultiValues["rate"], writes[i].MultiValues["rate"], reads[i].MultiValues["rate"])
+		}
+	}
+
+	perLabel := l.GetPerSecondEncodedLabelHistogramsMap()
+	if len(perLabel) != 2 || len(perLabel["write"]) != 1 || len(perLabel["read"]) != 1 {
+		t.Fatalf("per label per second histograms = %v, want write at 1000 and read at 1001", perLabel)
+	}
+	for label, want := range map[string]struct {
+		ts    uint64
+		count int64
+	}{"write": {1000, 6}, "read": {1001, 4}} {
+		hist, err := hdrhistogram.Decode([]byte(perLabel[label][want.ts]))
+		if err != nil {
+			t.Fatalf("decoding %s histogram at %d: %v", label, want.ts, err)
+		}
+		if hist.TotalCount() != want.count {
+			t.Errorf("%s histogram at %d has %d commands, want %d", label, want.ts, hist.TotalCount(), want.count)
+		}
+	}
+}
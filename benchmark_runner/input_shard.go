@@ -0,0 +1,160 @@
+package benchmark_runner
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inputShard is the part of the input read by one scanner goroutine, together
+// with the workers it feeds. Without --input-readers there is a single shard
+// covering the whole input (file or STDIN). Otherwise the input file is split
+// into byte ranges that start and end at line boundaries, and each range gets
+// its own scanner, its own subset of workers and its own share of --requests.
+type inputShard struct {
+	// byte range [offset, offset+size) of the input file; whole marks the
+	// single-shard case, which reads through l.br instead
+	offset, size int64
+	whole        bool
+
+	workers  uint
+	limit    uint64
+	channels []*duplexChannel
+}
+
+// createShards splits the input among --input-readers scanners, dealing the
+// workers and --requests limit evenly across them, and creates each shard's
+// worker channels.
+func (l *BenchmarkRunner) createShards(workQueues uint) []*inputShard {
+	readers := l.inputReaders
+	if readers > 1 && l.file == nil {
+		log.Printf("Warning! --input-readers %d requires --input; reading STDIN with a single reader", readers)
+		readers = 1
+	}
+	if readers > l.workers {
+		log.Printf("Warning! --input-readers %d is above --workers %d; using %d readers", readers, l.workers, l.workers)
+		readers = l.workers
+	}
+	if l.limit > 0 && uint64(readers) > l.limit {
+		// Every shard needs at least one request: a 0 limit means unlimited.
+		readers = uint(l.limit)
+	}
+	if readers <= 1 {
+		return []*inputShard{{whole: true, workers: l.workers, limit: l.limit, channels: l.createChannelsFor(workQueues, l.workers)}}
+	}
+
+	var bounds []int64
+	fi, err := l.file.Stat()
+	if err == nil {
+		bounds, err = lineBoundaries(l.file, fi.Size(), int(readers))
+	}
+	if err != nil {
+		log.Fatalf("cannot split input file %s for %d readers: %v", l.fileName, readers, err)
+	}
+	shards := make([]*inputShard, 0, len(bounds)-1)
+	n := uint(len(bounds) - 1)
+	for i := uint(0); i < n; i++ {
+		workers := l.workers / n
+		if i < l.workers%n {
+			workers++
+		}
+		limit := l.limit / uint64(n)
+		if uint64(i) < l.limit%uint64(n) {
+			limit++
+		}
+		shards = append(shards, &inputShard{
+			offset:   bounds[i],
+			size:     bounds[i+1] - bounds[i],
+			workers:  workers,
+			limit:    limit,
+			channels: l.createChannelsFor(workQueues, workers),
+		})
+	}
+	return shards
+}
+
+// lineBoundaries returns up to parts+1 increasing offsets splitting file (of
+// the given size) into byte ranges of roughly equal size, each starting right
+// after a newline (or at 0). Ranges that would be empty, e.g. on a file with
+// fewer lines than parts, are dropped.
+func lineBoundaries(file io.ReaderAt, size int64, parts int) ([]int64, error) {
+	bounds := []int64{0}
+	for i := 1; i < parts; i++ {
+		target := size * int64(i) / int64(parts)
+		if target <= bounds[len(bounds)-1] {
+			continue
+		}
+		// Start scanning at target-1 so a newline right before target makes
+		// target itself the boundary.
+		br := bufio.NewReader(io.NewSectionReader(file, target-1, size-target+1))
+		lineLen := 0
+		for {
+			chunk, err := br.ReadSlice('\n')
+			lineLen += len(chunk)
+			if err == nil {
+				break
+			} else if err == io.EOF {
+				// No newline left: the rest of the file belongs to the last range.
+				return append(bounds, size), nil
+			} else if err != bufio.ErrBufferFull {
+				return nil, err
+			}
+		}
+		boundary := target - 1 + int64(lineLen)
+		if boundary > bounds[len(bounds)-1] && boundary < size {
+			bounds = append(bounds, boundary)
+		}
+	}
+	return append(bounds, size), nil
+}
+
+// shardReader returns a buffered reader over the shard's byte range.
+func (l *BenchmarkRunner) shardReader(shard *inputShard) *bufio.Reader {
+	return bufio.NewReaderSize(io.NewSectionReader(l.file, shard.offset, shard.size), defaultReadSize)
+}
+
+// shardResetReaderFunc is GetResetReaderFunc for one shard: it rewinds to the
+// start of the shard's byte range rather than of the file.
+func (l *BenchmarkRunner) shardResetReaderFunc(b Benchmark, shard *inputShard, shardNum int) func() (*bufio.Reader, DocDecoder) {
+	rewindCount := 0
+	lastLog := time.Now().Add(-15 * time.Second) // allow immediate log on first rewind
+	return func() (*bufio.Reader, DocDecoder) {
+		rewindCount++
+		if time.Since(lastLog) > 10*time.Second {
+			log.Printf("Rewinding input file %s shard %d (rewinds so far: %d)", l.fileName, shardNum, rewindCount)
+			lastLog = time.Now()
+		}
+		newReader := l.shardReader(shard)
+		return newReader, b.GetCmdDecoder(newReader, l.maxTokenSizeMB)
+	}
+}
+
+// scanShards runs one scanner goroutine per shard and returns the total items
+// read. The scanners' own wall times and stalls are summed into
+// scanTime/scanStall.
+func (l *BenchmarkRunner) scanShards(ctx context.Context, b Benchmark, shards []*inputShard) uint64 {
+	var itemsRead uint64
+	var scanNanos, stallNanos int64
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard *inputShard) {
+			defer wg.Done()
+			start := time.Now()
+			br := l.shardReader(shard)
+			items, stall := scanWithTimeout(ctx, shard.channels, l.batchSize, shard.limit, l.Duration, br, b.GetCmdDecoder(br, l.maxTokenSizeMB),
+				b.GetBatchFactory(), b.GetCommandIndexer(uint(len(shard.channels))), l.shardResetReaderFunc(b, shard, i))
+			atomic.AddUint64(&itemsRead, items)
+			atomic.AddInt64(&scanNanos, int64(time.Since(start)))
+			atomic.AddInt64(&stallNanos, int64(stall))
+		}(i, shard)
+	}
+	wg.Wait()
+	l.scanTime = time.Duration(scanNanos)
+	l.scanStall = time.Duration(stallNanos)
+	return itemsRead
+}
@@ -0,0 +1,97 @@
+package benchmark_runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// Every boundary must fall right after a newline, and the ranges must cover
+// the whole input without overlap, whatever the line lengths.
+func TestLineBoundariesSplitAtNewlines(t *testing.T) {
+	input := "a\nbbbbbbbbbbbbbbbbbbbb\nc\ndd\neeeeeeeeeeeeeeeeeeeeeeeeeeeeeee\nf\n"
+	for parts := 1; parts <= 10; parts++ {
+		bounds, err := lineBoundaries(strings.NewReader(input), int64(len(input)), parts)
+		if err != nil {
+			t.Fatalf("parts=%d: %v", parts, err)
+		}
+		if bounds[0] != 0 || bounds[len(bounds)-1] != int64(len(input)) {
+			t.Fatalf("parts=%d: bounds %v do not cover [0, %d]", parts, bounds, len(input))
+		}
+		if len(bounds)-1 > parts {
+			t.Fatalf("parts=%d: got %d ranges", parts, len(bounds)-1)
+		}
+		for i := 1; i < len(bounds)-1; i++ {
+			if bounds[i] <= bounds[i-1] || input[bounds[i]-1] != '\n' {
+				t.Fatalf("parts=%d: boundary %d at %d is not right after a newline (bounds %v)", parts, i, bounds[i], bounds)
+			}
+		}
+	}
+}
+
+// A file without a trailing newline, or with a single huge line, must still be
+// covered by the ranges.
+func TestLineBoundariesSingleLine(t *testing.T) {
+	input := strings.Repeat("x", 10000)
+	bounds, err := lineBoundaries(strings.NewReader(input), int64(len(input)), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bounds) != 2 || bounds[1] != int64(len(input)) {
+		t.Fatalf("bounds = %v, want [0 %d]", bounds, len(input))
+	}
+}
+
+// runShardedScan scans a file of the given lines with readers shards and
+// discarding workers, returning the items read.
+func runShardedScan(t *testing.T, lines int, readers uint, limit uint64) uint64 {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte(discardInput(lines)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := &BenchmarkRunner{workers: 8, batchSize: 10, inputReaders: readers, limit: limit, fileName: path, maxTokenSizeMB: 1}
+	l.GetBufferedReader()
+	defer l.file.Close()
+
+	shards := l.createShards(SingleQueue)
+	var wg sync.WaitGroup
+	bench := lineBenchmark{}
+	workerNum := 0
+	for _, shard := range shards {
+		for i := 0; i < int(shard.workers); i++ {
+			wg.Add(1)
+			go l.work(bench, &wg, shard.channels[i%len(shard.channels)], workerNum, rate.NewLimiter(Inf, 1), false)
+			workerNum++
+		}
+	}
+	if workerNum != 8 {
+		t.Fatalf("shards drive %d workers, want 8", workerNum)
+	}
+	read := l.scan(bench, shards, l.start)
+	for _, shard := range shards {
+		for _, c := range shard.channels {
+			c.close()
+		}
+	}
+	wg.Wait()
+	return read
+}
+
+func TestShardedScanReadsEveryLineOnce(t *testing.T) {
+	if got := runShardedScan(t, 10007, 4, 0); got != 10007 {
+		t.Fatalf("4 readers scanned %d items, want 10007", got)
+	}
+}
+
+// --requests keeps its meaning across shards: the limit is dealt among them and
+// each shard rewinds within its own range to reach its share.
+func TestShardedScanHonorsRequestsWithRewind(t *testing.T) {
+	if got := runShardedScan(t, 101, 3, 1000); got != 1000 {
+		t.Fatalf("3 readers scanned %d items, want --requests 1000", got)
+	}
+}
@@ -0,0 +1,79 @@
+package benchmark_runner
+
+import (
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// allCommandsKey is the OverallQuantiles key of all commands combined.
+const allCommandsKey = "allCommands"
+
+// labelQuantileKeys maps each command label to its OverallQuantiles key.
+var labelQuantileKeys = map[string]string{
+	"SETUP_WRITE": "setupWrite",
+	"WRITE":       "write",
+	"UPDATE":      "update",
+	"READ":        "read",
+	"READ_CURSOR": "readCursor",
+	"DELETE":      "delete",
+}
+
+// outcomeHistograms splits the latencies of one OverallQuantiles key between
+// successful and failed commands, so fast error replies (e.g. OOM rejections)
+// do not drag the reported percentiles down.
+type outcomeHistograms struct {
+	success *hdrhistogram.Histogram
+	errors  *hdrhistogram.Histogram
+}
+
+// recordOutcome records a command's latency under its label, its
+// "LABEL-queryId" and allCommands, split by outcome. Callers hold
+// detailedMapHistogramsMutex, which guards outcomeHistograms.
+func (l *BenchmarkRunner) recordOutcome(label, groupAndQuery string, latency int64, failed bool) {
+	if l.outcomeHistograms == nil {
+		l.outcomeHistograms = map[string]*outcomeHistograms{}
+	}
+	keys := [3]string{allCommandsKey, labelQuantileKeys[label], groupAndQuery}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		h, exist := l.outcomeHistograms[key]
+		if !exist {
+			h = &outcomeHistograms{
+				success: hdrhistogram.New(1, l.maxLatency(), 3),
+				errors:  hdrhistogram.New(1, l.maxLatency(), 3),
+			}
+			l.outcomeHistograms[key] = h
+		}
+		if failed {
+			_ = h.errors.RecordValue(latency)
+		} else {
+			_ = h.success.RecordValue(latency)
+		}
+	}
+}
+
+// quantileHistograms returns the histograms OverallQuantiles and the summary
+// report for key: the successful commands' (or, with --latency-include-errors,
+// all commands' hist) and the failed commands', which is nil when none failed.
+func (l *BenchmarkRunner) quantileHistograms(key string, hist *hdrhistogram.Histogram) (reported, errors *hdrhistogram.Histogram) {
+	h, exist := l.outcomeHistograms[key]
+	if !exist {
+		return hist, nil
+	}
+	reported = h.success
+	if l.latencyIncludeErrors {
+		reported = hist
+	}
+	if h.errors.TotalCount() > 0 {
+		errors = h.errors
+	}
+	return reported, errors
+}
+
+// summaryQ50 returns the "Overall stats" q50 (ms) of key, over the same
+// commands as OverallQuantiles and the percentiles summary.
+func (l *BenchmarkRunner) summaryQ50(key string, hist *hdrhistogram.Histogram) float64 {
+	reported, _ := l.quantileHistograms(key, hist)
+	return l.latencyToMillis(reported.ValueAtQuantile(50.0))
+}
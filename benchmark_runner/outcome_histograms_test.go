@@ -0,0 +1,59 @@
+package benchmark_runner
+
+import "testing"
+
+func TestOverallQuantilesSplitSuccessAndErrors(t *testing.T) {
+	l := newTestRunner()
+	for i := 0; i < 100; i++ {
+		// slow successes, fast OOM-like rejections
+		l.recordCmdStat(*NewCmdStat([]byte("WRITE"), []byte("W1"), 10000, false, false, 0, 10))
+		l.recordCmdStat(*NewCmdStat([]byte("WRITE"), []byte("W1"), 10, true, false, 0, 10))
+	}
+	l.recordCmdStat(*NewCmdStat([]byte("READ"), []byte("R1"), 2000, false, false, 0, 10))
+
+	quantiles := l.GetOverallQuantiles()
+	q50 := func(key string) float64 {
+		mp, ok := quantiles[key].(map[string]float64)
+		if !ok {
+			t.Fatalf("OverallQuantiles has no %s: %v", key, quantiles)
+		}
+		return mp["q50"]
+	}
+	for _, key := range []string{"write", "WRITE-W1"} {
+		if q := q50(key); q < 9.9 || q > 10.1 {
+			t.Errorf("%s q50 = %v ms, want the successes' 10", key, q)
+		}
+		if q := q50(key + "Errors"); q < 0.009 || q > 0.011 {
+			t.Errorf("%sErrors q50 = %v ms, want the errors' 0.01", key, q)
+		}
+	}
+	if q := q50("allCommands"); q < 9.9 || q > 10.1 {
+		t.Errorf("allCommands q50 = %v ms, want 10", q)
+	}
+	for _, key := range []string{"readErrors", "READ-R1Errors", "deleteErrors"} {
+		if _, ok := quantiles[key]; ok {
+			t.Errorf("unexpected %s without failed commands", key)
+		}
+	}
+
+	// the headline q50 of the summary agrees with OverallQuantiles
+	if q := l.summaryQ50("write", l.writeHistogram); q < 9.9 || q > 10.1 {
+		t.Errorf("summary write q50 = %v ms, want the successes' 10", q)
+	}
+	if q := l.summaryQ50(allCommandsKey, l.totalHistogram); q < 9.9 || q > 10.1 {
+		t.Errorf("summary total q50 = %v ms, want 10", q)
+	}
+
+	// --latency-include-errors restores the mixed quantiles
+	l.latencyIncludeErrors = true
+	quantiles = l.GetOverallQuantiles()
+	if q := q50("write"); q > 0.011 {
+		t.Errorf("write q50 including errors = %v ms, want the errors' 0.01", q)
+	}
+	if q := l.summaryQ50("write", l.writeHistogram); q > 0.011 {
+		t.Errorf("summary write q50 including errors = %v ms, want the errors' 0.01", q)
+	}
+	if _, ok := quantiles["writeErrors"]; !ok {
+		t.Error("writeErrors should still be reported with --latency-include-errors")
+	}
+}
@@ -0,0 +1,55 @@
+package benchmark_runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultPercentiles are the percentiles reported when --percentiles is not
+// set. Their keys (q0, q50, q95, q99, q999, q100) are what existing dashboards
+// and report consumers read, so keep them stable.
+const defaultPercentiles = "0,50,95,99,99.9,100"
+
+var defaultQuantiles, _ = parsePercentiles(defaultPercentiles)
+
+// quantile is one reported percentile and the key it is stored under in
+// OverallQuantiles and the TimeSeries datapoints.
+type quantile struct {
+	key        string
+	percentile float64
+}
+
+// parsePercentiles parses a comma separated list of percentiles in [0, 100]
+// (e.g. "50,90,99,99.9,99.99"). Each is keyed "q" followed by its digits
+// without the decimal point: 99.9 -> q999, 99.99 -> q9999.
+func parsePercentiles(list string) ([]quantile, error) {
+	quantiles := []quantile{}
+	seen := map[string]float64{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentile %q: %w", field, err)
+		}
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("percentile %q out of range [0, 100]", field)
+		}
+		key := "q" + strings.Replace(strconv.FormatFloat(p, 'f', -1, 64), ".", "", 1)
+		if prev, exist := seen[key]; exist {
+			if prev == p {
+				continue
+			}
+			return nil, fmt.Errorf("percentiles %v and %v both map to key %s", prev, p, key)
+		}
+		seen[key] = p
+		quantiles = append(quantiles, quantile{key: key, percentile: p})
+	}
+	if len(quantiles) == 0 {
+		return nil, fmt.Errorf("no percentiles in %q", list)
+	}
+	return quantiles, nil
+}
@@ -0,0 +1,105 @@
+package benchmark_runner
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func quantileKeys(quantiles []quantile) []string {
+	keys := make([]string, 0, len(quantiles))
+	for _, q := range quantiles {
+		keys = append(keys, q.key)
+	}
+	return keys
+}
+
+func TestParsePercentilesKeys(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{defaultPercentiles, []string{"q0", "q50", "q95", "q99", "q999", "q100"}},
+		{"50,90,99,99.9,99.99,99.999", []string{"q50", "q90", "q99", "q999", "q9999", "q99999"}},
+		{" 99.9 , 50,", []string{"q999", "q50"}},
+		{"50,50.0", []string{"q50"}},
+	}
+	for _, tt := range tests {
+		got, err := parsePercentiles(tt.list)
+		if err != nil {
+			t.Fatalf("parsePercentiles(%q) error: %v", tt.list, err)
+		}
+		if keys := quantileKeys(got); !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("parsePercentiles(%q) keys = %v, want %v", tt.list, keys, tt.want)
+		}
+	}
+}
+
+func TestParsePercentilesErrors(t *testing.T) {
+	for _, list := range []string{"", ",", "abc", "-1", "100.5", "9.99,99.9"} {
+		if _, err := parsePercentiles(list); err == nil {
+			t.Errorf("parsePercentiles(%q) expected an error", list)
+		}
+	}
+}
+
+func TestGenerateQuantileMapUsesConfiguredPercentiles(t *testing.T) {
+	l := newTestRunner()
+	quantiles, err := parsePercentiles("50,99.99")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.quantiles = quantiles
+	for v := int64(1); v <= 10000; v++ {
+		l.totalHistogram.RecordValue(v * 10)
+	}
+	_, mp := l.generateQuantileMap(l.totalHistogram)
+	if len(mp) != 2 {
+		t.Fatalf("expected 2 quantiles, got %v", mp)
+	}
+	if q := mp["q50"]; q < 49.5 || q > 50.5 {
+		t.Errorf("q50 = %v ms, want ~50", q)
+	}
+	if q := mp["q9999"]; q < 99.5 || q > 100.5 {
+		t.Errorf("q9999 = %v ms, want ~100", q)
+	}
+
+	// a runner that never parsed --percentiles reports the defaults
+	l.quantiles = nil
+	_, mp = l.generateQuantileMap(l.totalHistogram)
+	for _, key := range []string{"q0", "q50", "q95", "q99", "q999", "q100"} {
+		if _, ok := mp[key]; !ok {
+			t.Errorf("default quantile %s missing from %v", key, mp)
+		}
+	}
+}
+
+func TestNanosecondLatencyUnit(t *testing.T) {
+	l := &BenchmarkRunner{maxLatencySeconds: 2, latencyUnit: time.Nanosecond}
+	if got := l.maxLatency(); got != 2_000_000_000 {
+		t.Errorf("maxLatency() = %d ns, want 2e9", got)
+	}
+	if got := l.latencyUnitString(); got != "ns" {
+		t.Errorf("latencyUnitString() = %q, want ns", got)
+	}
+	l.initHistograms()
+	// 1.5s is trackable, and sub-microsecond latencies keep their resolution
+	l.totalHistogram.RecordValue(1_500_000_000)
+	for v := int64(1); v <= 1000; v++ {
+		l.readHistogram.RecordValue(v)
+	}
+	_, mp := l.generateQuantileMap(l.totalHistogram)
+	if q := mp["q100"]; q < 1499 || q > 1501 {
+		t.Errorf("q100 = %v ms, want ~1500", q)
+	}
+	_, mp = l.generateQuantileMap(l.readHistogram)
+	if q := mp["q50"]; q != 0.0005 {
+		t.Errorf("q50 = %v ms, want 0.0005", q)
+	}
+
+	// microseconds stay the default
+	l = &BenchmarkRunner{}
+	if got, unit := l.maxLatency(), l.LatencyUnit(); got != 1_000_000 || unit != time.Microsecond {
+		t.Errorf("default maxLatency() = %d in %v, want 1e6 in 1µs", got, unit)
+	}
+}
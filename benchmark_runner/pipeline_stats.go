@@ -0,0 +1,105 @@
+package benchmark_runner
+
+import (
+	"fmt"
+	"log"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// maxPipelineSize caps the commands per round-trip tracked by the pipeline
+// size histogram.
+const maxPipelineSize = 1 << 20
+
+// pipelineStats separates the two latencies of pipelined commands: the
+// round-trip of every flush, shared by all the commands it carried (and so
+// what the latency histograms record for each of them), and the amortized
+// per-command latency, the round-trip divided by the commands in it. Without
+// pipelining both match the command latency.
+type pipelineStats struct {
+	roundTrips *hdrhistogram.Histogram
+	sizes      *hdrhistogram.Histogram
+	// amortized per OverallQuantiles key, allCommands included
+	amortized map[string]*hdrhistogram.Histogram
+}
+
+// recordPipeline records the round-trip and pipeline size of cmdStat's flush
+// when it is its first command, whether or not it failed, so every flush is
+// counted once. Like the OverallQuantiles, the amortized latency leaves failed
+// commands out unless --latency-include-errors is set. Callers hold
+// histogramsMutex, which guards pipelineStats.
+func (l *BenchmarkRunner) recordPipeline(label string, cmdStat CmdStat) {
+	p := l.pipelineStats
+	if p == nil {
+		p = &pipelineStats{
+			roundTrips: hdrhistogram.New(1, l.maxLatency(), 3),
+			sizes:      hdrhistogram.New(1, maxPipelineSize, 2),
+			amortized:  map[string]*hdrhistogram.Histogram{},
+		}
+		l.pipelineStats = p
+	}
+	latency := int64(cmdStat.Latency())
+	size := int64(cmdStat.PipelineSize())
+	if cmdStat.RoundTrip() {
+		_ = p.roundTrips.RecordValue(latency)
+		_ = p.sizes.RecordValue(size)
+	}
+	if cmdStat.Error() && !l.latencyIncludeErrors {
+		return
+	}
+	amortized := latency / size
+	if amortized == 0 {
+		amortized = 1
+	}
+	keys := []string{allCommandsKey}
+	if labelKey, ok := labelQuantileKeys[label]; ok {
+		keys = append(keys, labelKey)
+	}
+	for _, k := range keys {
+		hist, exist := p.amortized[k]
+		if !exist {
+			hist = hdrhistogram.New(1, l.maxLatency(), 3)
+			p.amortized[k] = hist
+		}
+		_ = hist.RecordValue(amortized)
+	}
+}
+
+// GetPipelineStatsMap returns the number of round-trips, the distribution of
+// their latency and of the commands per round-trip, and the amortized
+// per-command latency quantiles per label and of all commands.
+func (l *BenchmarkRunner) GetPipelineStatsMap() map[string]interface{} {
+	l.histogramsMutex.Lock()
+	defer l.histogramsMutex.Unlock()
+	p := l.pipelineStats
+	if p == nil {
+		return nil
+	}
+	configs := map[string]interface{}{}
+	configs["RoundTrips"] = p.roundTrips.TotalCount()
+	_, configs["RoundTripQuantiles"] = l.generateQuantileMap(p.roundTrips)
+	configs["PipelineSize"] = l.valueQuantileMap(p.sizes)
+	amortized := map[string]interface{}{}
+	for k, hist := range p.amortized {
+		_, amortized[k] = l.generateQuantileMap(hist)
+	}
+	configs["AmortizedQuantiles"] = amortized
+	return configs
+}
+
+// pipelineSummary prints the round-trip and amortized per-command latencies
+// next to each other, when commands were pipelined. The amortized latency is
+// left out when no command counted towards it, e.g. when all of them failed.
+func (l *BenchmarkRunner) pipelineSummary() {
+	p := l.pipelineStats
+	if p == nil || p.sizes.Max() <= 1 {
+		return
+	}
+	amortized := ""
+	if hist, ok := p.amortized[allCommandsKey]; ok && hist.TotalCount() > 0 {
+		amortized = fmt.Sprintf(", amortized per-command q50 lat %0.3f ms", l.latencyToMillis(hist.ValueAtQuantile(50.0)))
+	}
+	log.Printf("\tPipelining: %d round-trips of %.1f commands on average, round-trip q50 lat %0.3f ms%s\n",
+		p.roundTrips.TotalCount(), p.sizes.Mean(),
+		l.latencyToMillis(p.roundTrips.ValueAtQuantile(50.0)), amortized)
+}
@@ -0,0 +1,109 @@
+package benchmark_runner
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// recordFlush records the commands of one round-trip of latency, as
+// flushPending does.
+func recordFlush(l *BenchmarkRunner, label string, size int, latency uint64, failed bool) {
+	for i := 0; i < size; i++ {
+		cs := NewCmdStat([]byte(label), []byte("Q1"), latency, failed, false, 10, 10)
+		cs.SetPipeline(uint32(size), i == 0)
+		l.recordCmdStat(*cs)
+	}
+}
+
+func TestPipelineStatsRoundTripsAndAmortizedLatency(t *testing.T) {
+	l := newTestRunner()
+	if l.GetPipelineStatsMap() != nil {
+		t.Fatal("expected no PipelineStats without commands")
+	}
+	for i := 0; i < 10; i++ {
+		recordFlush(l, "READ", 10, 1000, false)
+	}
+	recordFlush(l, "WRITE", 4, 2, false)
+	recordFlush(l, "READ", 10, 50000, true) // counted, but not amortized
+
+	stats := l.GetPipelineStatsMap()
+	if stats["RoundTrips"] != int64(12) {
+		t.Errorf("RoundTrips = %v, want 12", stats["RoundTrips"])
+	}
+	if got := stats["RoundTripQuantiles"].(map[string]float64)["q50"]; got != 1 {
+		t.Errorf("round-trip q50 = %v ms, want 1", got)
+	}
+	if got := stats["PipelineSize"].(map[string]float64)["q100"]; got != 10 {
+		t.Errorf("max pipeline size = %v, want 10", got)
+	}
+	amortized := stats["AmortizedQuantiles"].(map[string]interface{})
+	if got := amortized["read"].(map[string]float64)["q100"]; got != 0.1 {
+		t.Errorf("amortized read q100 = %v ms, want 0.1", got)
+	}
+	// 2us over 4 commands floors to 1us
+	if got := amortized["write"].(map[string]float64)["q100"]; got != 0.001 {
+		t.Errorf("amortized write q100 = %v ms, want 0.001", got)
+	}
+	if got := l.pipelineStats.amortized[allCommandsKey].TotalCount(); got != 104 {
+		t.Errorf("amortized allCommands count = %d, want 104", got)
+	}
+
+	// a command sent alone is its own round-trip
+	l = newTestRunner()
+	l.recordCmdStat(*NewCmdStat([]byte("READ"), []byte("Q1"), 1000, false, false, 10, 10))
+	stats = l.GetPipelineStatsMap()
+	if stats["RoundTrips"] != int64(1) || stats["PipelineSize"].(map[string]float64)["q100"] != 1 {
+		t.Errorf("unpipelined command stats = %v, want 1 round-trip of 1 command", stats)
+	}
+}
+
+// A round-trip is counted once whichever of its commands failed, the first one
+// (which carries the round-trip) included.
+func TestPipelineStatsRoundTripWithFailedCommands(t *testing.T) {
+	for _, failedIdx := range []int{0, 3} {
+		l := newTestRunner()
+		for i := 0; i < 4; i++ {
+			cs := NewCmdStat([]byte("READ"), []byte("Q1"), 1000, i == failedIdx, false, 10, 10)
+			cs.SetPipeline(4, i == 0)
+			l.recordCmdStat(*cs)
+		}
+		stats := l.GetPipelineStatsMap()
+		if stats["RoundTrips"] != int64(1) || stats["PipelineSize"].(map[string]float64)["q100"] != 4 {
+			t.Errorf("command %d failed: stats = %v, want 1 round-trip of 4 commands", failedIdx, stats)
+		}
+		if got := l.pipelineStats.amortized["read"].TotalCount(); got != 3 {
+			t.Errorf("command %d failed: amortized read count = %d, want the 3 successes", failedIdx, got)
+		}
+	}
+}
+
+// A pipelined run whose every command failed has round-trips but no amortized
+// latency to report, unless --latency-include-errors.
+func TestPipelineSummaryAllCommandsFailed(t *testing.T) {
+	var out bytes.Buffer
+	prevLog := log.Writer()
+	log.SetOutput(&out)
+	defer log.SetOutput(prevLog)
+
+	l := newTestRunner()
+	recordFlush(l, "WRITE", 4, 1000, true)
+	l.pipelineSummary()
+	if !strings.Contains(out.String(), "1 round-trips of 4.0 commands") || strings.Contains(out.String(), "amortized") {
+		t.Errorf("summary = %q, want the round-trip without an amortized latency", out.String())
+	}
+	stats := l.GetPipelineStatsMap()
+	if stats["RoundTrips"] != int64(1) || len(stats["AmortizedQuantiles"].(map[string]interface{})) != 0 {
+		t.Errorf("stats = %v, want 1 round-trip and no amortized quantiles", stats)
+	}
+
+	out.Reset()
+	l = newTestRunner()
+	l.latencyIncludeErrors = true
+	recordFlush(l, "WRITE", 4, 1000, true)
+	l.pipelineSummary()
+	if !strings.Contains(out.String(), "amortized per-command q50 lat 0.250 ms") {
+		t.Errorf("summary = %q, want the failed commands' amortized latency", out.String())
+	}
+}
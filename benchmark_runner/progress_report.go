@@ -0,0 +1,238 @@
+package benchmark_runner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// --report-format values
+const (
+	reportFormatText = "text"
+	reportFormatJSON = "json"
+	reportFormatCSV  = "csv"
+)
+
+// progressLabelKeys are the Labels of the progress records, in CSV column
+// order.
+var progressLabelKeys = []string{allCommandsKey, "setupWrite", "write", "update", "read", "readCursor", "delete"}
+
+// progressRecord is the --report-format json record of one reporting period.
+// TotalOps is the running total, the other counts are the period's. Labels
+// (by OverallQuantiles key) and Queries (by "LABEL-queryId") hold the period's
+// rate, latency quantiles (ms) and errors; Queries also have the errors per
+// class as errors_<class>.
+type progressRecord struct {
+	Timestamp      int64                         `json:"Timestamp"`
+	ElapsedSeconds float64                       `json:"ElapsedSeconds"`
+	PeriodSeconds  float64                       `json:"PeriodSeconds"`
+	TotalOps       int64                         `json:"TotalOps"`
+	Errors         uint64                        `json:"Errors"`
+	Timeouts       uint64                        `json:"Timeouts"`
+	TxBytes        uint64                        `json:"TxBytes"`
+	RxBytes        uint64                        `json:"RxBytes"`
+	TxByteRate     float64                       `json:"TxByteRate"`
+	RxByteRate     float64                       `json:"RxByteRate"`
+	Labels         map[string]map[string]float64 `json:"Labels"`
+	Queries        map[string]map[string]float64 `json:"Queries,omitempty"`
+}
+
+// progressWriter writes a progressRecord per reporting period, in place of
+// the human readable progress lines, to stdout or --report-file. It is only
+// used by the reporter goroutine.
+type progressWriter struct {
+	format string
+	file   *os.File // nil when writing to stdout
+	json   *json.Encoder
+	csv    *csv.Writer
+	header bool
+	err    error
+
+	prevErrors, prevTimeouts uint64
+}
+
+// newProgressWriter returns the writer of --report-format, or nil for the
+// default text format.
+func newProgressWriter(format, fileName string) (*progressWriter, error) {
+	switch format {
+	case "", reportFormatText:
+		return nil, nil
+	case reportFormatJSON, reportFormatCSV:
+	default:
+		return nil, fmt.Errorf("must be %s, %s or %s", reportFormatText, reportFormatJSON, reportFormatCSV)
+	}
+	p := &progressWriter{format: format}
+	var w io.Writer = os.Stdout
+	if fileName != "" {
+		file, err := os.Create(fileName)
+		if err != nil {
+			return nil, err
+		}
+		p.file = file
+		w = file
+	}
+	if format == reportFormatJSON {
+		p.json = json.NewEncoder(w)
+	} else {
+		p.csv = csv.NewWriter(w)
+	}
+	return p, nil
+}
+
+// write writes record, warning once and dropping the later records when the
+// output fails.
+func (p *progressWriter) write(record progressRecord, quantiles []quantile) {
+	if p.err != nil {
+		return
+	}
+	if p.json != nil {
+		p.err = p.json.Encode(record)
+	} else {
+		if !p.header {
+			p.header = true
+			p.err = p.csv.Write(progressCSVHeader(quantiles))
+		}
+		if p.err == nil {
+			p.err = p.csv.Write(progressCSVRow(record, quantiles))
+		}
+		p.csv.Flush()
+		if p.err == nil {
+			p.err = p.csv.Error()
+		}
+	}
+	if p.err != nil {
+		log.Printf("Warning! Cannot write the --report-format %s records, dropping them: %v", p.format, p.err)
+	}
+}
+
+func (p *progressWriter) close() {
+	if p.file != nil {
+		if err := p.file.Close(); err != nil && p.err == nil {
+			log.Printf("Warning! Cannot write the --report-format %s records: %v", p.format, err)
+		}
+	}
+}
+
+// progressCSVHeader returns the CSV columns: the period's counts, then the
+// rate, errors and quantiles of every progressLabelKeys label.
+func progressCSVHeader(quantiles []quantile) []string {
+	header := []string{"timestamp", "elapsed_seconds", "period_seconds", "total_ops", "errors", "timeouts", "tx_bytes", "rx_bytes", "tx_byte_rate", "rx_byte_rate"}
+	for _, label := range progressLabelKeys {
+		header = append(header, label+"_rate", label+"_errors")
+		for _, q := range quantiles {
+			header = append(header, label+"_"+q.key)
+		}
+	}
+	return header
+}
+
+func progressCSVRow(record progressRecord, quantiles []quantile) []string {
+	formatFloat := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	formatUint := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	row := []string{
+		strconv.FormatInt(record.Timestamp, 10),
+		formatFloat(record.ElapsedSeconds),
+		formatFloat(record.PeriodSeconds),
+		strconv.FormatInt(record.TotalOps, 10),
+		formatUint(record.Errors),
+		formatUint(record.Timeouts),
+		formatUint(record.TxBytes),
+		formatUint(record.RxBytes),
+		formatFloat(record.TxByteRate),
+		formatFloat(record.RxByteRate),
+	}
+	for _, label := range progressLabelKeys {
+		values := record.Labels[label]
+		row = append(row, formatFloat(values["rate"]), formatFloat(values["errors"]))
+		for _, q := range quantiles {
+			row = append(row, formatFloat(values[q.key]))
+		}
+	}
+	return row
+}
+
+// progressLabelSeries returns the per-label timeseries whose latest datapoints
+// are the Labels of the progress records.
+func (l *BenchmarkRunner) progressLabelSeries() map[string][]DataPoint {
+	return map[string][]DataPoint{
+		allCommandsKey: l.totalTs,
+		"setupWrite":   l.setupWriteTs,
+		"write":        l.writeTs,
+		"update":       l.updateTs,
+		"read":         l.readTs,
+		"readCursor":   l.readCursorTs,
+		"delete":       l.deleteTs,
+	}
+}
+
+// progressRecord builds the record of the period of length took ending at
+// now, from the datapoints the reporter just added. txBytes and rxBytes are
+// the period's. Only called by the reporter, after it added the datapoints.
+func (l *BenchmarkRunner) progressRecord(now, start time.Time, took time.Duration, totalOps int64, txBytes, rxBytes uint64) progressRecord {
+	p := l.progress
+	errors := atomic.LoadUint64(&l.totalErrors)
+	timeouts := atomic.LoadUint64(&l.totalTimeouts)
+	record := progressRecord{
+		Timestamp:      now.UnixMilli(),
+		ElapsedSeconds: now.Sub(start).Seconds(),
+		PeriodSeconds:  took.Seconds(),
+		TotalOps:       totalOps,
+		Errors:         errors - p.prevErrors,
+		Timeouts:       timeouts - p.prevTimeouts,
+		TxBytes:        txBytes,
+		RxBytes:        rxBytes,
+		TxByteRate:     float64(txBytes) / took.Seconds(),
+		RxByteRate:     float64(rxBytes) / took.Seconds(),
+		Labels:         map[string]map[string]float64{},
+	}
+	p.prevErrors, p.prevTimeouts = errors, timeouts
+
+	labelErrors := map[string]float64{}
+	l.detailedMapHistogramsMutex.RLock()
+	for k, datapoints := range l.detailedTs {
+		if len(datapoints) == 0 {
+			continue
+		}
+		values := copyValues(datapoints[len(datapoints)-1].MultiValues)
+		errs := 0.0
+		for name, v := range values {
+			if strings.HasPrefix(name, "errors_") {
+				errs += v
+			}
+		}
+		values["errors"] = errs
+		if record.Queries == nil {
+			record.Queries = map[string]map[string]float64{}
+		}
+		record.Queries[k] = values
+		label, _, _ := strings.Cut(k, "-")
+		labelErrors[labelQuantileKeys[label]] += errs
+	}
+	l.detailedMapHistogramsMutex.RUnlock()
+	labelErrors[allCommandsKey] = float64(record.Errors)
+
+	for key, series := range l.progressLabelSeries() {
+		if len(series) == 0 {
+			continue
+		}
+		values := copyValues(series[len(series)-1].MultiValues)
+		values["errors"] = labelErrors[key]
+		record.Labels[key] = values
+	}
+	return record
+}
+
+func copyValues(values map[string]float64) map[string]float64 {
+	c := make(map[string]float64, len(values)+1)
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,130 @@
+package benchmark_runner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// reportPeriod records the commands of one reporting period and builds its
+// progress record, as the reporter does.
+func reportPeriod(t *testing.T, l *BenchmarkRunner, start time.Time) progressRecord {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		cs := NewCmdStat([]byte("READ"), []byte("R1"), 1000, i < 2, false, 100, 10)
+		if i < 2 {
+			cs.SetErrorClass("OOM")
+		}
+		l.recordCmdStat(*cs)
+	}
+	l.recordCmdStat(*NewCmdStat([]byte("WRITE"), []byte("W1"), 2000, false, false, 5, 50))
+	now := start.Add(2 * time.Second)
+	took := 2 * time.Second
+	l.totalTs = l.addRateMetricsDatapoints(l.totalTs, now, took, l.inst_totalHistogram)
+	l.readTs = l.addRateMetricsDatapoints(l.readTs, now, took, l.inst_readHistogram)
+	l.writeTs = l.addRateMetricsDatapoints(l.writeTs, now, took, l.inst_writeHistogram)
+	for _, hist := range []*hdrhistogram.Histogram{l.inst_totalHistogram, l.inst_readHistogram, l.inst_writeHistogram} {
+		hist.Reset()
+	}
+	l.addDetailedDatapoints(now, took)
+	return l.progressRecord(now, start, took, int64(l.totalOps), 150, 1005)
+}
+
+func TestProgressRecordJSON(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "progress.json")
+	l := newTestRunner()
+	var err error
+	if l.progress, err = newProgressWriter(reportFormatJSON, fileName); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1700000000, 0)
+	l.progress.write(reportPeriod(t, l, start), l.reportedQuantiles())
+	l.progress.close()
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record progressRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("invalid record %s: %v", data, err)
+	}
+	if record.Timestamp != 1700000002000 || record.TotalOps != 11 || record.Errors != 2 || record.RxBytes != 1005 || record.RxByteRate != 502.5 {
+		t.Errorf("unexpected record totals %+v", record)
+	}
+	if read := record.Labels["read"]; read["rate"] != 5 || read["errors"] != 2 || read["q50"] != 1 {
+		t.Errorf("read = %v, want rate 5, 2 errors, q50 1ms", read)
+	}
+	if all := record.Labels[allCommandsKey]; all["rate"] != 5.5 || all["errors"] != 2 {
+		t.Errorf("allCommands = %v, want rate 5.5 and 2 errors", all)
+	}
+	if r1 := record.Queries["READ-R1"]; r1["errors_OOM"] != 2 || r1["errors"] != 2 {
+		t.Errorf("READ-R1 = %v, want 2 OOM errors", r1)
+	}
+	if _, ok := record.Labels["delete"]; ok {
+		t.Errorf("labels without datapoints should be left out: %v", record.Labels)
+	}
+}
+
+func TestProgressRecordCSV(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "progress.csv")
+	l := newTestRunner()
+	var err error
+	if l.progress, err = newProgressWriter(reportFormatCSV, fileName); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1700000000, 0)
+	l.progress.write(reportPeriod(t, l, start), l.reportedQuantiles())
+	l.progress.write(reportPeriod(t, l, start.Add(2*time.Second)), l.reportedQuantiles())
+	l.progress.close()
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %d", len(rows))
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	for _, want := range []struct{ column, value string }{
+		{"total_ops", "22"},
+		{"errors", "2"},
+		{"read_errors", "2"},
+		{"write_rate", "0.5"},
+		{"write_q50", "2"},
+		{"delete_rate", "0"},
+	} {
+		i, ok := columns[want.column]
+		if !ok {
+			t.Errorf("missing column %s in %v", want.column, rows[0])
+			continue
+		}
+		if got := rows[2][i]; got != want.value {
+			t.Errorf("%s = %s, want %s", want.column, got, want.value)
+		}
+	}
+}
+
+func TestNewProgressWriterFormats(t *testing.T) {
+	for _, format := range []string{"", reportFormatText} {
+		if p, err := newProgressWriter(format, ""); p != nil || err != nil {
+			t.Errorf("newProgressWriter(%q) = %v, %v, want the text format", format, p, err)
+		}
+	}
+	if _, err := newProgressWriter("xml", ""); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
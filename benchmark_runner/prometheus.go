@@ -0,0 +1,159 @@
+package benchmark_runner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// promQueryCounters are the --prometheus-listen counters of one
+// "LABEL-queryId", guarded by detailedMapHistogramsMutex. Its latency
+// quantiles come from detailedMapHistograms.
+type promQueryCounters struct {
+	label, queryId        string
+	ops, errors, timeouts uint64
+	txBytes, rxBytes      uint64
+	latencySum            uint64 // in the latency unit
+}
+
+// promMetrics are the exposed counters, in exposition order.
+var promMetrics = []struct {
+	name, help string
+	value      func(c *promQueryCounters) uint64
+}{
+	{"ftsb_commands_total", "Commands issued.", func(c *promQueryCounters) uint64 { return c.ops }},
+	{"ftsb_command_errors_total", "Commands that failed.", func(c *promQueryCounters) uint64 { return c.errors }},
+	{"ftsb_command_timeouts_total", "Commands that timed out.", func(c *promQueryCounters) uint64 { return c.timeouts }},
+	{"ftsb_tx_bytes_total", "Bytes sent.", func(c *promQueryCounters) uint64 { return c.txBytes }},
+	{"ftsb_rx_bytes_total", "Bytes received.", func(c *promQueryCounters) uint64 { return c.rxBytes }},
+}
+
+// startPrometheus listens on --prometheus-listen and serves the metrics of
+// the run in the Prometheus text format on /metrics, until stopPrometheus.
+func (l *BenchmarkRunner) startPrometheus() {
+	ln, err := net.Listen("tcp", l.prometheusListen)
+	if err != nil {
+		log.Fatalf("cannot listen on --prometheus-listen %s: %v", l.prometheusListen, err)
+	}
+	l.detailedMapHistogramsMutex.Lock()
+	l.promCounters = map[string]*promQueryCounters{}
+	l.detailedMapHistogramsMutex.Unlock()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		l.writePrometheusMetrics(w)
+	})
+	l.promServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := l.promServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("Warning! Prometheus endpoint stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving Prometheus metrics on http://%s/metrics\n", ln.Addr())
+}
+
+// stopPrometheus closes the --prometheus-listen endpoint.
+func (l *BenchmarkRunner) stopPrometheus() {
+	if l.promServer != nil {
+		_ = l.promServer.Close()
+	}
+}
+
+// recordPromCounters counts cmdStat in its "LABEL-queryId" counters. Callers
+// hold detailedMapHistogramsMutex and only call it with --prometheus-listen.
+func (l *BenchmarkRunner) recordPromCounters(label, groupAndQuery string, cmdStat CmdStat) {
+	c, exist := l.promCounters[groupAndQuery]
+	if !exist {
+		c = &promQueryCounters{label: label, queryId: string(cmdStat.CmdQueryId())}
+		l.promCounters[groupAndQuery] = c
+	}
+	c.ops++
+	if cmdStat.Error() {
+		c.errors++
+	}
+	if cmdStat.TimedOut() {
+		c.timeouts++
+	}
+	c.txBytes += cmdStat.Tx()
+	c.rxBytes += cmdStat.Rx()
+	c.latencySum += cmdStat.Latency()
+}
+
+// promSnapshot is the copy of one "LABEL-queryId" that the metrics are
+// written from, once detailedMapHistogramsMutex is released.
+type promSnapshot struct {
+	counters  promQueryCounters
+	quantiles []float64 // in seconds, per reported quantile; nil without a histogram
+}
+
+// writePrometheusMetrics writes the counters and a latency summary (in
+// seconds, over all commands, failed ones included) of every label and query
+// id in the Prometheus text exposition format. They are copied under
+// detailedMapHistogramsMutex and written after releasing it, so a slow scraper
+// never holds up the workers recording commands.
+func (l *BenchmarkRunner) writePrometheusMetrics(out io.Writer) {
+	quantiles := l.reportedQuantiles()
+	secondsPerUnit := l.LatencyUnit().Seconds()
+	l.detailedMapHistogramsMutex.RLock()
+	keys := make([]string, 0, len(l.promCounters))
+	for k := range l.promCounters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	snapshots := make([]promSnapshot, len(keys))
+	for i, k := range keys {
+		snapshots[i].counters = *l.promCounters[k]
+		if hist, ok := l.detailedMapHistograms[k]; ok {
+			snapshots[i].quantiles = make([]float64, len(quantiles))
+			for j, q := range quantiles {
+				snapshots[i].quantiles[j] = float64(hist.ValueAtQuantile(q.percentile)) * secondsPerUnit
+			}
+		}
+	}
+	l.detailedMapHistogramsMutex.RUnlock()
+
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	for _, m := range promMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", m.name, m.help, m.name)
+		for i := range snapshots {
+			c := &snapshots[i].counters
+			fmt.Fprintf(w, "%s{%s} %d\n", m.name, promLabels(c), m.value(c))
+		}
+	}
+
+	const latency = "ftsb_command_latency_seconds"
+	fmt.Fprintf(w, "# HELP %s Command latency.\n# TYPE %s summary\n", latency, latency)
+	for i := range snapshots {
+		c := &snapshots[i].counters
+		labels := promLabels(c)
+		for j, value := range snapshots[i].quantiles {
+			// rounded so e.g. 99.9 is exposed as 0.999, not 0.9990000000000001
+			quantile := math.Round(quantiles[j].percentile*1e6) / 1e8
+			fmt.Fprintf(w, "%s{%s,quantile=\"%s\"} %s\n", latency, labels,
+				strconv.FormatFloat(quantile, 'g', -1, 64), strconv.FormatFloat(value, 'g', -1, 64))
+		}
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", latency, labels, strconv.FormatFloat(float64(c.latencySum)*secondsPerUnit, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", latency, labels, c.ops)
+	}
+}
+
+// promLabels returns the label and query_id labels of c.
+func promLabels(c *promQueryCounters) string {
+	return fmt.Sprintf("label=\"%s\",query_id=\"%s\"", promEscape(c.label), promEscape(c.queryId))
+}
+
+// promEscaper escapes label values per the text exposition format.
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promEscape(s string) string {
+	return promEscaper.Replace(s)
+}
@@ -0,0 +1,91 @@
+package benchmark_runner
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheusMetrics(t *testing.T) {
+	l := newTestRunner()
+	quantiles, err := parsePercentiles("50,99.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.quantiles = quantiles
+	l.promCounters = map[string]*promQueryCounters{}
+	for i := 0; i < 4; i++ {
+		l.recordCmdStat(*NewCmdStat([]byte("READ"), []byte("R1"), 1000, i == 0, i == 0, 100, 10))
+	}
+	l.recordCmdStat(*NewCmdStat([]byte("WRITE"), []byte(`W"1`), 2000, false, false, 5, 50))
+
+	var buf bytes.Buffer
+	l.writePrometheusMetrics(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE ftsb_commands_total counter\n",
+		`ftsb_commands_total{label="READ",query_id="R1"} 4` + "\n",
+		`ftsb_command_errors_total{label="READ",query_id="R1"} 1` + "\n",
+		`ftsb_command_timeouts_total{label="READ",query_id="R1"} 1` + "\n",
+		`ftsb_tx_bytes_total{label="READ",query_id="R1"} 40` + "\n",
+		`ftsb_rx_bytes_total{label="WRITE",query_id="W\"1"} 5` + "\n",
+		"# TYPE ftsb_command_latency_seconds summary\n",
+		`ftsb_command_latency_seconds{label="READ",query_id="R1",quantile="0.5"} 0.001` + "\n",
+		`ftsb_command_latency_seconds{label="READ",query_id="R1",quantile="0.999"} 0.001` + "\n",
+		`ftsb_command_latency_seconds_sum{label="READ",query_id="R1"} 0.004` + "\n",
+		`ftsb_command_latency_seconds_count{label="WRITE",query_id="W\"1"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q:\n%s", want, out)
+		}
+	}
+}
+
+// stalledWriter blocks every Write until release is closed, like a scraper
+// that stopped reading.
+type stalledWriter struct {
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	select {
+	case w.writing <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return len(p), nil
+}
+
+// A stalled scraper must not hold up the workers: the metrics are written
+// without holding detailedMapHistogramsMutex.
+func TestWritePrometheusMetricsDoesNotBlockRecording(t *testing.T) {
+	l := newTestRunner()
+	l.promCounters = map[string]*promQueryCounters{}
+	// enough query ids to overflow the write buffer mid-way
+	for i := 0; i < 200; i++ {
+		l.recordCmdStat(*NewCmdStat([]byte("READ"), []byte(fmt.Sprintf("R%d", i)), 1000, false, false, 100, 10))
+	}
+	w := &stalledWriter{writing: make(chan struct{}, 1), release: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		l.writePrometheusMetrics(w)
+		close(done)
+	}()
+	<-w.writing
+
+	recorded := make(chan struct{})
+	go func() {
+		l.recordCmdStat(*NewCmdStat([]byte("READ"), []byte("R0"), 1000, false, false, 100, 10))
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Error("recordCmdStat blocked behind a stalled scrape")
+	}
+	close(w.release)
+	<-done
+}
@@ -0,0 +1,25 @@
+package benchmark_runner
+
+// QueryProfiler is implemented by Benchmarks that profile a sample of their
+// queries out of band, e.g. with FT.PROFILE on a connection of their own, so
+// the profiled runs stay out of the latency histograms.
+type QueryProfiler interface {
+	// StopProfiling is called once all workers are done, and returns once the
+	// profiles in flight are recorded.
+	StopProfiling()
+
+	// GetQueryProfilesMap returns the aggregated profiles per
+	// "LABEL-queryId", or nil when nothing was profiled.
+	GetQueryProfilesMap() map[string]interface{}
+}
+
+// stopQueryProfiler stops b's profiling, if it profiles its queries, and
+// returns the aggregated profiles.
+func stopQueryProfiler(b Benchmark) map[string]interface{} {
+	profiler, ok := b.(QueryProfiler)
+	if !ok {
+		return nil
+	}
+	profiler.StopProfiling()
+	return profiler.GetQueryProfilesMap()
+}
@@ -0,0 +1,104 @@
+package benchmark_runner
+
+import (
+	"log"
+	"sort"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// maxReplyStatValue caps the reply sizes (bytes) and result counts tracked by
+// the reply histograms, which keep 2 significant digits: plenty to correlate
+// with latency, at a fraction of the memory of the latency histograms.
+const maxReplyStatValue = 1 << 32
+
+// replyStats holds the reply size and result count distributions of one
+// "LABEL-queryId". results is only filled for commands that report a total
+// results count (FT.SEARCH, FT.AGGREGATE, FT.CURSOR READ).
+type replyStats struct {
+	bytes       *hdrhistogram.Histogram
+	results     *hdrhistogram.Histogram
+	zeroResults int64
+}
+
+// recordReply records the reply size and results count of a successful
+// command whose reply was captured (--capture-replies). Callers hold
+// detailedMapHistogramsMutex, which guards replyStats.
+func (l *BenchmarkRunner) recordReply(groupAndQuery string, cmdStat CmdStat) {
+	if !cmdStat.ReplyCaptured() || cmdStat.Error() {
+		return
+	}
+	if l.replyStats == nil {
+		l.replyStats = map[string]*replyStats{}
+	}
+	r, exist := l.replyStats[groupAndQuery]
+	if !exist {
+		r = &replyStats{
+			bytes:   hdrhistogram.New(1, maxReplyStatValue, 2),
+			results: hdrhistogram.New(1, maxReplyStatValue, 2),
+		}
+		l.replyStats[groupAndQuery] = r
+	}
+	_ = r.bytes.RecordValue(int64(cmdStat.Rx()))
+	if results, ok := cmdStat.Results(); ok {
+		_ = r.results.RecordValue(int64(results))
+		if results == 0 {
+			r.zeroResults++
+		}
+	}
+}
+
+// valueQuantileMap is generateQuantileMap for histograms of plain values
+// (bytes, counts) rather than microsecond latencies, plus their mean.
+func (l *BenchmarkRunner) valueQuantileMap(hist *hdrhistogram.Histogram) map[string]float64 {
+	mp := map[string]float64{}
+	for _, q := range l.reportedQuantiles() {
+		// ValueAtQuantile(0) is always 0, which for sizes and counts would read
+		// as empty replies
+		value := hist.ValueAtQuantile(q.percentile)
+		if q.percentile == 0 {
+			value = hist.Min()
+		}
+		mp[q.key] = float64(value)
+	}
+	mp["mean"] = wrapNaN(hist.Mean())
+	return mp
+}
+
+// GetReplyStatsMap returns, per "LABEL-queryId" with captured replies, the
+// distribution of reply bytes and, where available, of the total results count
+// along with how many commands returned no results.
+func (l *BenchmarkRunner) GetReplyStatsMap() map[string]interface{} {
+	if len(l.replyStats) == 0 {
+		return nil
+	}
+	configs := map[string]interface{}{}
+	for k, r := range l.replyStats {
+		mp := map[string]interface{}{}
+		mp["Replies"] = r.bytes.TotalCount()
+		mp["ReplyBytes"] = l.valueQuantileMap(r.bytes)
+		if r.results.TotalCount() > 0 {
+			mp["Results"] = l.valueQuantileMap(r.results)
+			mp["ZeroResults"] = r.zeroResults
+		}
+		configs[k] = mp
+	}
+	return configs
+}
+
+// replyStatsSummary warns about queries that returned no results at all, or
+// for part of their commands.
+func (l *BenchmarkRunner) replyStatsSummary() {
+	keys := make([]string, 0, len(l.replyStats))
+	for k := range l.replyStats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r := l.replyStats[k]
+		if r.zeroResults > 0 {
+			log.Printf("\tWarning! %s returned no results for %d of %d commands (%.2f%%)\n",
+				k, r.zeroResults, r.results.TotalCount(), float64(r.zeroResults)/float64(r.results.TotalCount())*100.0)
+		}
+	}
+}
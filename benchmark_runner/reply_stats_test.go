@@ -0,0 +1,44 @@
+package benchmark_runner
+
+import "testing"
+
+func recordReplyStat(l *BenchmarkRunner, queryId string, rx uint64, results int64, failed bool) {
+	cs := NewCmdStat([]byte("READ"), []byte(queryId), 100, failed, false, rx, 10)
+	cs.SetReplyCaptured(true)
+	if results >= 0 {
+		cs.SetResults(uint64(results))
+	}
+	l.recordCmdStat(*cs)
+}
+
+func TestReplyStatsPerQueryId(t *testing.T) {
+	l := newTestRunner()
+	// not captured: no reply stats at all
+	l.recordCmdStat(*NewCmdStat([]byte("READ"), []byte("R1"), 100, false, false, 0, 10))
+	if l.GetReplyStatsMap() != nil {
+		t.Fatal("expected no ReplyStats without captured replies")
+	}
+
+	for i := int64(1); i <= 10; i++ {
+		recordReplyStat(l, "R1", uint64(i*100), i, false)
+	}
+	recordReplyStat(l, "R1", 20, 0, false)
+	recordReplyStat(l, "R1", 20, 0, true) // failed commands are ignored
+	recordReplyStat(l, "R2", 5, -1, false)
+
+	stats := l.GetReplyStatsMap()
+	r1 := stats["READ-R1"].(map[string]interface{})
+	if r1["Replies"] != int64(11) || r1["ZeroResults"] != int64(1) {
+		t.Errorf("READ-R1 = %v, want 11 replies, 1 with zero results", r1)
+	}
+	if got := r1["Results"].(map[string]float64)["q100"]; got != 10 {
+		t.Errorf("READ-R1 max results = %v, want 10", got)
+	}
+	if got := r1["ReplyBytes"].(map[string]float64)["q0"]; got != 20 {
+		t.Errorf("READ-R1 min reply bytes = %v, want 20", got)
+	}
+	r2 := stats["READ-R2"].(map[string]interface{})
+	if _, ok := r2["Results"]; ok || r2["Replies"] != int64(1) {
+		t.Errorf("READ-R2 = %v, want 1 reply and no results distribution", r2)
+	}
+}
@@ -3,39 +3,101 @@ package benchmark_runner
 import (
 	"bufio"
 	"context"
-	"reflect"
 	"time"
 )
 
-// ackAndMaybeSend adjust the unsent batches count
-// and sends one batch (if any available) to the worker via ch.
-// Returns the updated state of unsent
-func ackAndMaybeSend(ch *duplexChannel, count *int, unsent []Batch) []Batch {
-	*count--
+// dispatcher hands full batches to the workers' channels and does the flow
+// control between the scanner and the workers. Workers acknowledge processed
+// batches on a single channel shared by every duplexChannel (carrying the
+// channel index), so the scanner can poll or block on acks with a plain channel
+// operation instead of a reflect.Select over every channel for every item.
+type dispatcher struct {
+	channels []*duplexChannel
+	acks     <-chan int
+
+	// unsent contains, per channel, batches ready to be sent to a worker.
+	// As soon as a worker's chan is available (i.e., not blocking), the batch
+	// is placed onto that worker's chan.
+	unsent [][]Batch
+
+	// Keep track of how many batches are outstanding (ocnt), so we don't go
+	// over a limit (olimit), in order to slow down the scanner so it doesn't
+	// starve the workers
+	ocnt   int
+	olimit int
+
+	// stall is the time the scanner spent blocked waiting for workers to
+	// acknowledge batches, i.e. the time the input was outrun by the workers'
+	// consumers rather than the other way around.
+	stall time.Duration
+}
+
+func newDispatcher(channels []*duplexChannel) *dispatcher {
+	unsent := make([][]Batch, len(channels))
+	for i := range unsent {
+		unsent[i] = []Batch{}
+	}
+	return &dispatcher{
+		channels: channels,
+		acks:     channels[0].toScanner,
+		unsent:   unsent,
+		olimit:   len(channels) * cap(channels[0].toWorker) * 3,
+	}
+}
+
+// ack adjusts the outstanding batches count for an acknowledgement from
+// channel idx and sends that channel its next unsent batch (if any).
+func (d *dispatcher) ack(idx int) {
+	d.ocnt--
 	// If there are still batches waiting, send the next
-	if len(unsent) > 0 {
-		ch.sendToWorker(unsent[0])
-		if len(unsent) > 1 {
-			return unsent[1:]
+	if unsent := d.unsent[idx]; len(unsent) > 0 {
+		d.channels[idx].sendToWorker(unsent[0])
+		d.unsent[idx] = unsent[1:]
+	}
+}
+
+// drainAcks processes every acknowledgement already received without blocking.
+func (d *dispatcher) drainAcks() {
+	for {
+		select {
+		case idx := <-d.acks:
+			d.ack(idx)
+		default:
+			return
 		}
-		return unsent[:0]
 	}
-	return unsent
 }
 
-// sendOrQueueBatch attempts to send a Batch of databuild on a duplexChannel.
-// If it would block or there is other work to be sent first, the Batch is stored on a queue.
-// The count of outstanding work is adjusted upwards
-func sendOrQueueBatch(ch *duplexChannel, count *int, batch Batch, unsent []Batch) []Batch {
+// dispatch sends a full batch to channel idx, or queues it if that would block
+// or there is other work to be sent first. When too many batches are
+// outstanding it waits for workers to catch up.
+func (d *dispatcher) dispatch(idx int, batch Batch) {
+	d.drainAcks()
 	// In case there are no outstanding batches yet and there are empty positions in toWorker queue
 	// we can send/put batch into toWorker queue
-	*count++
-	if len(unsent) == 0 && len(ch.toWorker) < cap(ch.toWorker) {
+	d.ocnt++
+	ch := d.channels[idx]
+	if len(d.unsent[idx]) == 0 && len(ch.toWorker) < cap(ch.toWorker) {
 		ch.sendToWorker(batch)
 	} else {
-		return append(unsent, batch)
+		d.unsent[idx] = append(d.unsent[idx], batch)
+	}
+	if d.ocnt >= d.olimit {
+		// We have too many outstanding batches, wait until one finishes
+		stallStart := time.Now()
+		for d.ocnt >= d.olimit {
+			d.ack(<-d.acks)
+		}
+		d.stall += time.Since(stallStart)
+	}
+}
+
+// wait blocks until all the outstanding batches get acknowledged, so we don't
+// prematurely close the worker channels.
+func (d *dispatcher) wait() {
+	for d.ocnt > 0 {
+		d.ack(<-d.acks)
 	}
-	return unsent
 }
 
 // Batch is an aggregate of points for a particular databuild system.
@@ -100,9 +162,8 @@ func scanWithIndexer(channels []*duplexChannel, batchSize uint, limit uint64, br
 
 	// Batches details
 	// 1. fillingBatches contains batches that are being filled with items from scanner.
-	//    As soon a batch has batchSize items in it, or there is no more items to come, batch moves to unsentBatches.
-	// 2. unsentBatches contains batches ready to be sent to a worker.
-	//    As soon as a worker's chan is available (i.e., not blocking), the batch is placed onto that worker's chan.
+	//    As soon a batch has batchSize items in it, or there is no more items to come, batch is handed to the dispatcher.
+	// 2. The dispatcher sends it to a worker's chan right away, or queues it until that chan has room.
 
 	// Current batches (per channel) that are being filled with items from scanner
 	fillingBatches := make([]Batch, numChannels)
@@ -110,33 +171,7 @@ func scanWithIndexer(channels []*duplexChannel, batchSize uint, limit uint64, br
 		fillingBatches[i] = factory.New()
 	}
 
-	// Batches that are ready to be set when space on a channel opens
-	unsentBatches := make([][]Batch, numChannels)
-	for i := range unsentBatches {
-		unsentBatches[i] = []Batch{}
-	}
-
-	// We use Select via reflection to either select an acknowledged channel so
-	// that we can potentially send another batch, or if none are ready to continue
-	// on scanning. However, when we reach a limit of outstanding (unsent) batches,
-	// we also want to block until one worker is done, so as not to starve the workers.
-	// Using an array with Select via reflection gives us this flexibility (i.e.,
-	// we can either pass the whole array of cases, or the array less the last item).
-	cases := make([]reflect.SelectCase, numChannels+1)
-	for i, ch := range channels {
-		cases[i] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(ch.toScanner),
-		}
-	}
-	cases[numChannels] = reflect.SelectCase{
-		Dir: reflect.SelectDefault,
-	}
-
-	// Keep track of how many batches are outstanding (ocnt),
-	// so we don't go over a limit (olimit), in order to slow down the scanner so it doesn't starve the workers
-	ocnt := 0
-	olimit := numChannels * cap(channels[0].toWorker) * 3
+	d := newDispatcher(channels)
 	for {
 
 		// Check whether incoming items limit reached.
@@ -145,18 +180,6 @@ func scanWithIndexer(channels []*duplexChannel, batchSize uint, limit uint64, br
 			break
 		}
 
-		caseLimit := len(cases)
-		if ocnt >= olimit {
-			// We have too many outstanding batches, wait until one finishes (i.e. no default)
-			caseLimit--
-		}
-
-		// Only receive an 'ok' when it's from a channel, default does not return 'ok'
-		chosen, _, ok := reflect.Select(cases[:caseLimit])
-		if ok {
-			unsentBatches[chosen] = ackAndMaybeSend(channels[chosen], &ocnt, unsentBatches[chosen])
-		}
-
 		// Prepare new batch - decode new item and append it to batch
 		item := decoder.Decode(br)
 		if item == nil {
@@ -173,7 +196,7 @@ func scanWithIndexer(channels []*duplexChannel, batchSize uint, limit uint64, br
 		if fillingBatches[idx].Len() >= int(batchSize) {
 			// Batch is full (contains at least batchSize items) - ready to be sent to worker,
 			// or moved to outstanding, in case no workers available atm.
-			unsentBatches[idx] = sendOrQueueBatch(channels[idx], &ocnt, fillingBatches[idx], unsentBatches[idx])
+			d.dispatch(idx, fillingBatches[idx])
 			// Place new empty batch
 			fillingBatches[idx] = factory.New()
 		}
@@ -184,30 +207,22 @@ func scanWithIndexer(channels []*duplexChannel, batchSize uint, limit uint64, br
 	for idx, b := range fillingBatches {
 		// Do not enqueue empty batches (with 0 items)
 		if b.Len() > 0 {
-			unsentBatches[idx] = sendOrQueueBatch(channels[idx], &ocnt, fillingBatches[idx], unsentBatches[idx])
+			d.dispatch(idx, b)
 		}
 	}
 
 	// Wait until all the outstanding batches get acknowledged,
-	// so we don't prematurely close the acknowledge channels
-	for {
-		if ocnt == 0 {
-			// No outstanding batches any more
-			break
-		}
-
-		// Try to send batches to workers
-		chosen, _, ok := reflect.Select(cases[:len(cases)-1])
-		if ok {
-			unsentBatches[chosen] = ackAndMaybeSend(channels[chosen], &ocnt, unsentBatches[chosen])
-		}
-	}
+	// so we don't prematurely close the worker channels
+	d.wait()
 
 	return itemsRead
 }
 
+// scanWithTimeout is scanWithIndexer bounded by ctx, which also rewinds the input
+// (via resetReader) when a limit or duration outlasts it. It returns the items
+// read and the time the scanner stalled waiting for workers.
 func scanWithTimeout(ctx context.Context, channels []*duplexChannel, batchSize uint, limit uint64, duration time.Duration, br *bufio.Reader, decoder DocDecoder, factory BatchFactory, indexer DocIndexer,
-	resetReader func() (*bufio.Reader, DocDecoder)) uint64 {
+	resetReader func() (*bufio.Reader, DocDecoder)) (uint64, time.Duration) {
 	var itemsRead uint64
 	numChannels := len(channels)
 	if batchSize < 1 {
@@ -218,24 +233,7 @@ func scanWithTimeout(ctx context.Context, channels []*duplexChannel, batchSize u
 	for i := range fillingBatches {
 		fillingBatches[i] = factory.New()
 	}
-	unsentBatches := make([][]Batch, numChannels)
-	for i := range unsentBatches {
-		unsentBatches[i] = []Batch{}
-	}
-
-	cases := make([]reflect.SelectCase, numChannels+1)
-	for i, ch := range channels {
-		cases[i] = reflect.SelectCase{
-			Dir:  reflect.SelectRecv,
-			Chan: reflect.ValueOf(ch.toScanner),
-		}
-	}
-	cases[numChannels] = reflect.SelectCase{
-		Dir: reflect.SelectDefault,
-	}
-
-	ocnt := 0
-	olimit := numChannels * cap(channels[0].toWorker) * 3
+	d := newDispatcher(channels)
 
 SCAN_LOOP:
 	for {
@@ -247,16 +245,6 @@ SCAN_LOOP:
 				break SCAN_LOOP
 			}
 
-			caseLimit := len(cases)
-			if ocnt >= olimit {
-				caseLimit--
-			}
-
-			chosen, _, ok := reflect.Select(cases[:caseLimit])
-			if ok {
-				unsentBatches[chosen] = ackAndMaybeSend(channels[chosen], &ocnt, unsentBatches[chosen])
-			}
-
 			item := decoder.Decode(br)
 			if item == nil {
 				// If no limit or duration is set, do not rewind, just exit
@@ -279,7 +267,7 @@ SCAN_LOOP:
 			fillingBatches[idx].Append(item)
 
 			if fillingBatches[idx].Len() >= int(batchSize) {
-				unsentBatches[idx] = sendOrQueueBatch(channels[idx], &ocnt, fillingBatches[idx], unsentBatches[idx])
+				d.dispatch(idx, fillingBatches[idx])
 				fillingBatches[idx] = factory.New()
 			}
 		}
@@ -287,19 +275,11 @@ SCAN_LOOP:
 
 	for idx, b := range fillingBatches {
 		if b.Len() > 0 {
-			unsentBatches[idx] = sendOrQueueBatch(channels[idx], &ocnt, b, unsentBatches[idx])
+			d.dispatch(idx, b)
 		}
 	}
 
-	for {
-		if ocnt == 0 {
-			break
-		}
-		chosen, _, ok := reflect.Select(cases[:len(cases)-1])
-		if ok {
-			unsentBatches[chosen] = ackAndMaybeSend(channels[chosen], &ocnt, unsentBatches[chosen])
-		}
-	}
+	d.wait()
 
-	return itemsRead
+	return itemsRead, d.stall
 }
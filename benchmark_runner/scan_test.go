@@ -0,0 +1,112 @@
+package benchmark_runner
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// lineBenchmark is a minimal Benchmark whose items are raw input lines and
+// whose processor discards every batch, i.e. the runner's --do-benchmark=false
+// path with no database client involved.
+type lineBenchmark struct{}
+
+type lineDecoder struct{ scanner *bufio.Scanner }
+
+func (d *lineDecoder) Decode(_ *bufio.Reader) *DocHolder {
+	if !d.scanner.Scan() {
+		return nil
+	}
+	return NewDocument(d.scanner.Text())
+}
+
+type lineBatch struct{ rows []string }
+
+func (lb *lineBatch) Len() int            { return len(lb.rows) }
+func (lb *lineBatch) Append(i *DocHolder) { lb.rows = append(lb.rows, i.Data.(string)) }
+
+var lineBatchPool = &sync.Pool{New: func() interface{} { return &lineBatch{} }}
+
+type lineFactory struct{}
+
+func (f *lineFactory) New() Batch { return lineBatchPool.Get().(*lineBatch) }
+
+type lineIndexer struct{ partitions uint }
+
+func (i *lineIndexer) GetIndex(itemsRead uint64, _ *DocHolder) int {
+	return int(uint(itemsRead) % i.partitions)
+}
+
+type discardProcessor struct{}
+
+func (p *discardProcessor) Init(int, bool, int) {}
+func (p *discardProcessor) ProcessBatch(b Batch, _ bool, _ *rate.Limiter, _ bool) Stat {
+	lb := b.(*lineBatch)
+	lb.rows = lb.rows[:0]
+	lineBatchPool.Put(lb)
+	return *NewStat()
+}
+
+func (lineBenchmark) GetCmdDecoder(br *bufio.Reader, _ uint) DocDecoder {
+	return &lineDecoder{scanner: bufio.NewScanner(br)}
+}
+func (lineBenchmark) GetBatchFactory() BatchFactory { return &lineFactory{} }
+func (lineBenchmark) GetCommandIndexer(maxPartitions uint) DocIndexer {
+	return &lineIndexer{maxPartitions}
+}
+func (lineBenchmark) GetProcessor() Processor                               { return &discardProcessor{} }
+func (lineBenchmark) GetConfigurationParametersMap() map[string]interface{} { return nil }
+
+// discardInput returns n small command lines.
+func discardInput(n int) string {
+	return strings.Repeat("READ,R1,1,GET,key\n", n)
+}
+
+// runDiscardScan feeds input through the scanner to workers that discard it
+// (--do-benchmark=false) and returns the items read.
+func runDiscardScan(input string, workers uint, workQueues uint) uint64 {
+	l := &BenchmarkRunner{workers: workers, batchSize: 100}
+	channels := l.createChannels(workQueues)
+	var wg sync.WaitGroup
+	limiter := rate.NewLimiter(Inf, 1)
+	bench := lineBenchmark{}
+	for i := 0; i < int(workers); i++ {
+		wg.Add(1)
+		go l.work(bench, &wg, channels[i%len(channels)], i, limiter, false)
+	}
+	br := bufio.NewReader(strings.NewReader(input))
+	read, _ := scanWithTimeout(context.Background(), channels, l.batchSize, 0, 0, br, bench.GetCmdDecoder(br, 1),
+		bench.GetBatchFactory(), bench.GetCommandIndexer(uint(len(channels))), func() (*bufio.Reader, DocDecoder) { return nil, nil })
+	for _, c := range channels {
+		c.close()
+	}
+	wg.Wait()
+	return read
+}
+
+func TestScanDispatchesEveryItem(t *testing.T) {
+	for _, queues := range []uint{SingleQueue, WorkerPerQueue} {
+		if got := runDiscardScan(discardInput(12345), 8, queues); got != 12345 {
+			t.Fatalf("workQueues=%d: scanned %d items, want 12345", queues, got)
+		}
+	}
+}
+
+func benchmarkScan(b *testing.B, workQueues uint) {
+	input := discardInput(b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+	runDiscardScan(input, 8, workQueues)
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "items/s")
+}
+
+// BenchmarkScanSingleQueue measures how fast a single scanner can feed 8
+// workers through the shared queue, as ftsb_redisearch runs it.
+func BenchmarkScanSingleQueue(b *testing.B) { benchmarkScan(b, SingleQueue) }
+
+// BenchmarkScanWorkerPerQueue measures the same with one queue per worker.
+func BenchmarkScanWorkerPerQueue(b *testing.B) { benchmarkScan(b, WorkerPerQueue) }
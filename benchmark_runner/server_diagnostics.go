@@ -0,0 +1,13 @@
+package benchmark_runner
+
+// ServerDiagnostics is implemented by Benchmarks that capture server side
+// diagnostics, e.g. SLOWLOG and LATENCY, around the run.
+type ServerDiagnostics interface {
+	// ResetServerDiagnostics is called right before the benchmark clock
+	// starts.
+	ResetServerDiagnostics()
+
+	// GetServerDiagnosticsMap is called once all workers are done, and
+	// returns the diagnostics to attach to the TestResult.
+	GetServerDiagnosticsMap() map[string]interface{}
+}
@@ -0,0 +1,153 @@
+package benchmark_runner
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// ServerSampler samples the metrics of the server a Benchmark runs against,
+// e.g. from Redis INFO, on its own connection so the benchmark connections are
+// left untouched.
+type ServerSampler interface {
+	// SampleServer returns the current server metrics, by name.
+	SampleServer() (map[string]float64, error)
+
+	// Close releases the sampler's connection.
+	Close()
+}
+
+// ServerSamplerFactory is implemented by Benchmarks that can sample their
+// server. GetServerSampler returns nil when server sampling is disabled.
+type ServerSamplerFactory interface {
+	GetServerSampler() ServerSampler
+}
+
+// serverStats samples the server at the start and end of the run and, on its
+// own goroutine, every reporting period (serverTs). start and end are only
+// written before the sampler goroutine starts and after it is done.
+type serverStats struct {
+	sampler    ServerSampler
+	start, end map[string]float64
+	datapoints []DataPoint
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// startServerStats takes the opening sample, and starts sampling every period
+// when it is above 0. It returns nil when b does not sample its server or the
+// opening sample fails, e.g. because INFO is not permitted.
+func startServerStats(b Benchmark, period time.Duration) *serverStats {
+	factory, ok := b.(ServerSamplerFactory)
+	if !ok {
+		return nil
+	}
+	sampler := factory.GetServerSampler()
+	if sampler == nil {
+		return nil
+	}
+	start, err := sampler.SampleServer()
+	if err != nil {
+		log.Printf("Warning! Disabling server stats sampling: %v", err)
+		sampler.Close()
+		return nil
+	}
+	s := &serverStats{sampler: sampler, start: start}
+	if period > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.run(period)
+	}
+	return s
+}
+
+func (s *serverStats) run(period time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		sample, err := s.sampler.SampleServer()
+		if err != nil {
+			// a failed sample only costs its datapoint, no need to flood the log
+			if failures == 0 {
+				log.Printf("Warning! Server stats sampling failed: %v", err)
+			}
+			failures++
+			continue
+		}
+		datapoint := NewDataPoint(time.Now().Unix())
+		for k, v := range sample {
+			datapoint.AddValue(k, v)
+		}
+		s.datapoints = append(s.datapoints, *datapoint)
+	}
+}
+
+// finish stops the periodic sampling, takes the closing sample and closes the
+// sampler.
+func (s *serverStats) finish() {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	end, err := s.sampler.SampleServer()
+	if err != nil {
+		log.Printf("Warning! Server stats sampling failed at the end of the run: %v", err)
+	}
+	s.end = end
+	s.sampler.Close()
+}
+
+// delta returns end - start for the metrics present in both samples.
+func (s *serverStats) delta() map[string]float64 {
+	delta := map[string]float64{}
+	for k, end := range s.end {
+		if start, ok := s.start[k]; ok {
+			delta[k] = end - start
+		}
+	}
+	return delta
+}
+
+// GetServerStatsMap returns the server metrics at the start and end of the run
+// and their difference.
+func (l *BenchmarkRunner) GetServerStatsMap() map[string]interface{} {
+	s := l.serverStats
+	if s == nil {
+		return nil
+	}
+	configs := map[string]interface{}{}
+	configs["Start"] = s.start
+	configs["End"] = s.end
+	configs["Delta"] = s.delta()
+	return configs
+}
+
+// serverStatsSummary prints the server metrics that changed during the run.
+func (l *BenchmarkRunner) serverStatsSummary() {
+	s := l.serverStats
+	if s == nil || s.end == nil {
+		return
+	}
+	delta := s.delta()
+	keys := make([]string, 0, len(delta))
+	for k, v := range delta {
+		if v != 0 {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	log.Printf("\tServer stats (start -> end, delta):\n")
+	for _, k := range keys {
+		log.Printf("\t- %-40s\t%.3f -> %.3f\t%+.3f\n", k, s.start[k], s.end[k], delta[k])
+	}
+}
@@ -0,0 +1,93 @@
+package benchmark_runner
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSampler returns used_memory 100, 200, ... on each call, failing the
+// calls listed in fail.
+type fakeSampler struct {
+	calls  int32
+	fail   map[int32]bool
+	closed bool
+}
+
+func (s *fakeSampler) SampleServer() (map[string]float64, error) {
+	call := atomic.AddInt32(&s.calls, 1)
+	if s.fail[call] {
+		return nil, errors.New("NOPERM")
+	}
+	return map[string]float64{"used_memory": float64(100 * call), "constant": 1}, nil
+}
+
+func (s *fakeSampler) Close() { s.closed = true }
+
+type samplingBenchmark struct {
+	Benchmark
+	sampler *fakeSampler
+}
+
+func (b samplingBenchmark) GetServerSampler() ServerSampler {
+	if b.sampler == nil {
+		return nil
+	}
+	return b.sampler
+}
+
+func TestServerStatsStartEndAndTimeSeries(t *testing.T) {
+	sampler := &fakeSampler{fail: map[int32]bool{2: true}}
+	l := newTestRunner()
+	l.serverStats = startServerStats(samplingBenchmark{sampler: sampler}, 10*time.Millisecond)
+	if l.serverStats == nil {
+		t.Fatal("expected server stats sampling")
+	}
+	for atomic.LoadInt32(&sampler.calls) < 4 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	l.serverStats.finish()
+	if !sampler.closed {
+		t.Error("sampler not closed by finish")
+	}
+
+	calls := atomic.LoadInt32(&sampler.calls)
+	stats := l.GetServerStatsMap()
+	if got := stats["Start"].(map[string]float64)["used_memory"]; got != 100 {
+		t.Errorf("Start used_memory = %v, want 100", got)
+	}
+	if got := stats["End"].(map[string]float64)["used_memory"]; got != float64(100*calls) {
+		t.Errorf("End used_memory = %v, want %v", got, 100*calls)
+	}
+	delta := stats["Delta"].(map[string]float64)
+	if delta["used_memory"] != float64(100*(calls-1)) || delta["constant"] != 0 {
+		t.Errorf("Delta = %v", delta)
+	}
+
+	// the opening and closing samples and the failed one have no datapoint
+	serverTs := l.GetTimeSeriesMap()["serverTs"].([]DataPoint)
+	if len(serverTs) != int(calls)-3 {
+		t.Errorf("serverTs has %d datapoints, want %d", len(serverTs), calls-3)
+	}
+}
+
+func TestServerStatsDisabled(t *testing.T) {
+	if s := startServerStats(samplingBenchmark{}, time.Second); s != nil {
+		t.Error("expected no server stats without a sampler")
+	}
+	sampler := &fakeSampler{fail: map[int32]bool{1: true}}
+	if s := startServerStats(samplingBenchmark{sampler: sampler}, time.Second); s != nil {
+		t.Error("expected no server stats when the opening sample fails")
+	}
+	if !sampler.closed {
+		t.Error("sampler not closed after the opening sample failed")
+	}
+	l := newTestRunner()
+	if l.GetServerStatsMap() != nil {
+		t.Error("expected no ServerStats without sampling")
+	}
+	if _, ok := l.GetTimeSeriesMap()["serverTs"]; ok {
+		t.Error("expected no serverTs without sampling")
+	}
+}
@@ -1,10 +1,18 @@
 package benchmark_runner
 
+import "time"
+
 // Stat represents one statistical measurement, typically used to store the
 // latency of a command
 type Stat struct {
 	totalCmds uint64
 	cmdStats  []CmdStat
+
+	// input read-speed accounting, filled by processors that only parse their
+	// rows (--do-benchmark=false)
+	inputRows  uint64
+	inputBytes uint64
+	parseTime  time.Duration
 }
 
 func (s *Stat) CmdStats() []CmdStat {
@@ -24,6 +32,20 @@ type CmdStat struct {
 	timedOut      bool
 	rx            uint64 // bytes received (from Redis replies)
 	tx            uint64 // bytes sent (request/command bytes)
+	connId        uint32 // client connection the command was sent on
+	errorClass    string // kind of error, e.g. OOM or TIMEOUT, when error is set
+
+	// replyCaptured is set when the reply was decoded, making rx exact and
+	// results (total results of a search reply) available when hasResults
+	replyCaptured bool
+	results       uint64
+	hasResults    bool
+
+	// pipelineSize is how many commands shared the round-trip that latency
+	// measures, and roundTrip is set on the first of them only, so each
+	// round-trip is counted once. 0 when not set: the command was sent alone.
+	pipelineSize uint32
+	roundTrip    bool
 }
 
 func (c *CmdStat) StartTs() uint64 {
@@ -58,6 +80,14 @@ func (c *CmdStat) SetLatency(latency uint64) {
 	c.latency = latency
 }
 
+func (c *CmdStat) ConnId() uint32 {
+	return c.connId
+}
+
+func (c *CmdStat) SetConnId(connId uint32) {
+	c.connId = connId
+}
+
 func (c *CmdStat) Label() []byte {
 	return c.cmdQueryGroup
 }
@@ -78,6 +108,53 @@ func (c *CmdStat) TimedOut() bool {
 	return c.timedOut
 }
 
+func (c *CmdStat) ErrorClass() string {
+	return c.errorClass
+}
+
+func (c *CmdStat) SetErrorClass(errorClass string) {
+	c.errorClass = errorClass
+}
+
+func (c *CmdStat) ReplyCaptured() bool {
+	return c.replyCaptured
+}
+
+func (c *CmdStat) SetReplyCaptured(replyCaptured bool) {
+	c.replyCaptured = replyCaptured
+}
+
+// Results returns the total results count the reply reported, if any.
+func (c *CmdStat) Results() (uint64, bool) {
+	return c.results, c.hasResults
+}
+
+func (c *CmdStat) SetResults(results uint64) {
+	c.results = results
+	c.hasResults = true
+}
+
+// PipelineSize returns how many commands shared the command's round-trip.
+func (c *CmdStat) PipelineSize() uint32 {
+	if c.pipelineSize == 0 {
+		return 1
+	}
+	return c.pipelineSize
+}
+
+// RoundTrip reports whether the command stands for its round-trip: it was
+// the first command of its pipeline, or sent alone.
+func (c *CmdStat) RoundTrip() bool {
+	return c.pipelineSize == 0 || c.roundTrip
+}
+
+// SetPipeline records that the command was sent in a pipeline of size
+// commands, roundTrip being set on the first of them.
+func (c *CmdStat) SetPipeline(size uint32, roundTrip bool) {
+	c.pipelineSize = size
+	c.roundTrip = roundTrip
+}
+
 func NewCmdStat(cmdGroup []byte, cmdQueryId []byte, latency uint64, error bool, timedOut bool, rx uint64, tx uint64) *CmdStat {
 	return &CmdStat{cmdQueryGroup: cmdGroup, cmdQueryId: cmdQueryId, latency: latency, error: error, timedOut: timedOut, rx: rx, tx: tx}
 }
@@ -85,13 +162,13 @@ func NewCmdStat(cmdGroup []byte, cmdQueryId []byte, latency uint64, error bool,
 func NewStat() *Stat {
 	cmds := make([]CmdStat, 0, 0)
 	return &Stat{
-		0, cmds,
+		totalCmds: 0, cmdStats: cmds,
 	}
 }
 
 func (s *Stat) AddEntry(cmdGroup []byte, cmdQueryId []byte, startTs, latencyUs uint64, error bool, timedOut bool, rx, tx uint64) *Stat {
 	s.totalCmds++
-	entry := CmdStat{cmdGroup, cmdQueryId, startTs, latencyUs, error, timedOut, rx, tx}
+	entry := CmdStat{cmdQueryGroup: cmdGroup, cmdQueryId: cmdQueryId, startTs: startTs, latency: latencyUs, error: error, timedOut: timedOut, rx: rx, tx: tx}
 	s.cmdStats = append(s.cmdStats, entry)
 	return s
 }
@@ -103,6 +180,30 @@ func (s *Stat) GetCmdsCount() uint64 {
 func (s *Stat) Merge(stat Stat) {
 	s.totalCmds += stat.totalCmds
 	s.cmdStats = append(s.cmdStats, stat.cmdStats...)
+	s.inputRows += stat.inputRows
+	s.inputBytes += stat.inputBytes
+	s.parseTime += stat.parseTime
+}
+
+// AddInputRows accounts rows that were read and parsed, but not sent, along
+// with their size in bytes and the time spent parsing them.
+func (s *Stat) AddInputRows(rows, bytes uint64, parseTime time.Duration) *Stat {
+	s.inputRows += rows
+	s.inputBytes += bytes
+	s.parseTime += parseTime
+	return s
+}
+
+func (s *Stat) InputRows() uint64 {
+	return s.inputRows
+}
+
+func (s *Stat) InputBytes() uint64 {
+	return s.inputBytes
+}
+
+func (s *Stat) ParseTime() time.Duration {
+	return s.parseTime
 }
 
 func (s *Stat) AddCmdStatEntry(stat CmdStat) {
@@ -4,6 +4,7 @@ import (
 	"math"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
 )
@@ -126,3 +127,37 @@ func TestGetMeasuredRatiosMapEmptyInputIsZeroNotNaN(t *testing.T) {
 		}
 	}
 }
+
+// Every recorded command is attributed to the connection it was sent on, so
+// ConnectionCommandCounts can show whether --clients spread the load evenly.
+func TestRecordCmdStatCountsPerConnection(t *testing.T) {
+	l := newTestRunner()
+	for i := 0; i < 5; i++ {
+		cs := NewCmdStat([]byte("READ"), []byte("q1"), 10, false, false, 0, 0)
+		cs.SetConnId(uint32(i % 2))
+		l.recordCmdStat(*cs)
+	}
+	got := l.GetConnectionCommandCountsMap()
+	if got[0] != 3 || got[1] != 2 || len(got) != 2 {
+		t.Fatalf("ConnectionCommandCounts = %v, want map[0:3 1:2]", got)
+	}
+}
+
+// Input read-speed accounting survives Merge, and an empty --do-benchmark=false
+// run reports zeros rather than NaN (which json.Marshal rejects).
+func TestInputReadStats(t *testing.T) {
+	s := NewStat()
+	s.Merge(*NewStat().AddInputRows(3, 30, 3*time.Microsecond))
+	s.Merge(*NewStat().AddInputRows(1, 10, time.Microsecond))
+	if s.InputRows() != 4 || s.InputBytes() != 40 || s.ParseTime() != 4*time.Microsecond {
+		t.Fatalf("merged input stats = (%d, %d, %v), want (4, 40, 4µs)", s.InputRows(), s.InputBytes(), s.ParseTime())
+	}
+
+	l := newTestRunner()
+	l.end = l.start.Add(time.Second)
+	for k, v := range l.GetInputReadStatsMap() {
+		if f, ok := v.(float64); ok && math.IsNaN(f) {
+			t.Fatalf("%s is NaN on empty input", k)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package benchmark_runner
+
+import (
+	"log"
+	"math"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+)
+
+const (
+	// steadyStateMaxCV is the throughput coefficient of variation (stddev /
+	// mean) over the steady-state window below which the run is considered to
+	// have reached steady state.
+	steadyStateMaxCV = 0.1
+	// minSteadyStatePeriods is the fewest reporting periods a steady-state
+	// window can span.
+	minSteadyStatePeriods = 5
+)
+
+// mserTruncation returns how many leading values of x to drop so the rest is
+// the most stable, by the MSER rule: the truncation d, up to half the series,
+// minimizing sum((x[i] - mean(x[d:]))^2) / (len(x) - d)^2.
+func mserTruncation(x []float64) int {
+	best, bestD := math.Inf(1), 0
+	for d := 0; d <= len(x)/2; d++ {
+		rest := x[d:]
+		mean := meanOf(rest)
+		sse := 0.0
+		for _, v := range rest {
+			sse += (v - mean) * (v - mean)
+		}
+		if stat := sse / float64(len(rest)*len(rest)); stat < best {
+			best, bestD = stat, d
+		}
+	}
+	return bestD
+}
+
+func meanOf(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range x {
+		sum += v
+	}
+	return sum / float64(len(x))
+}
+
+// coefficientOfVariation returns the population stddev of x over its mean, or
+// 0 when the mean is 0.
+func coefficientOfVariation(x []float64) float64 {
+	mean := meanOf(x)
+	if mean == 0 {
+		return 0
+	}
+	variance := 0.0
+	for _, v := range x {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance/float64(len(x))) / mean
+}
+
+// steadyStateWindow returns the [from, to) range of the steady-state periods
+// of rates. MSER, from either end, finds the warm-up and ramp-down to trim;
+// as it also trims plain noise, the window is then extended back over the
+// periods within steadyStateMaxCV of its mean rate.
+func steadyStateWindow(rates []float64) (from, to int) {
+	from = mserTruncation(rates)
+	rest := rates[from:]
+	reversed := make([]float64, len(rest))
+	for i, v := range rest {
+		reversed[len(rest)-1-i] = v
+	}
+	to = len(rates) - mserTruncation(reversed)
+
+	mean := meanOf(rates[from:to])
+	within := func(v float64) bool { return math.Abs(v-mean) <= steadyStateMaxCV*mean }
+	for from > 0 && within(rates[from-1]) {
+		from--
+	}
+	for to < len(rates) && within(rates[to]) {
+		to++
+	}
+	return from, to
+}
+
+// tailQuantileKey returns the key of the reported percentile whose stability
+// is reported next to the throughput's: q99, or the closest one to it.
+func (l *BenchmarkRunner) tailQuantileKey() string {
+	key, best := "", math.Inf(1)
+	for _, q := range l.reportedQuantiles() {
+		if d := math.Abs(q.percentile - 99); d < best {
+			key, best = q.key, d
+		}
+	}
+	return key
+}
+
+// steadyStateSeries are the timeseries whose steady-state mean rate is
+// reported, by their OverallRates key.
+func (l *BenchmarkRunner) steadyStateSeries() map[string][]DataPoint {
+	return map[string][]DataPoint{
+		"setupWriteRate": l.setupWriteTs,
+		"writeRate":      l.writeTs,
+		"readRate":       l.readTs,
+		"readCursorRate": l.readCursorTs,
+		"updateRate":     l.updateTs,
+		"deleteRate":     l.deleteTs,
+		"overallOpsRate": l.totalTs,
+	}
+}
+
+// GetSteadyStateMap detects the steady-state window from the allCommands
+// reporting periods and returns it with the throughput and tail latency
+// coefficients of variation over the window and over the whole run, and the
+// window's rates and quantiles. The quantiles merge the per-second histograms
+// of the seconds the window spans and, like OverallQuantiles, cover the
+// successful commands unless --latency-include-errors. The tail CVs come from
+// the reporting periods' quantiles, which cover all commands, failed ones
+// included. Returns nil without reporting periods.
+func (l *BenchmarkRunner) GetSteadyStateMap() map[string]interface{} {
+	datapoints := l.totalTs
+	if len(datapoints) == 0 {
+		return nil
+	}
+	tailKey := l.tailQuantileKey()
+	rates := make([]float64, len(datapoints))
+	tails := make([]float64, len(datapoints))
+	for i, dp := range datapoints {
+		rates[i] = dp.MultiValues["rate"]
+		tails[i] = dp.MultiValues[tailKey]
+	}
+	configs := map[string]interface{}{}
+	configs["TotalPeriods"] = len(datapoints)
+	configs["TailQuantile"] = tailKey
+	configs["WholeRunThroughputCV"] = coefficientOfVariation(rates)
+	configs["WholeRunTailCV"] = coefficientOfVariation(tails)
+
+	from, to := steadyStateWindow(rates)
+	throughputCV := coefficientOfVariation(rates[from:to])
+	detected := to-from >= minSteadyStatePeriods && throughputCV <= steadyStateMaxCV
+	configs["Detected"] = detected
+	configs["WarmupPeriods"] = from
+	configs["RampDownPeriods"] = len(datapoints) - to
+	configs["Periods"] = to - from
+	configs["ThroughputCV"] = throughputCV
+	configs["TailCV"] = coefficientOfVariation(tails[from:to])
+	if !detected {
+		return configs
+	}
+
+	// datapoints are stamped at the end of their period, which starts at the
+	// previous datapoint (or the start of the run)
+	windowStart := l.start.Unix()
+	if from > 0 {
+		windowStart = datapoints[from-1].Timestamp
+	}
+	windowEnd := datapoints[to-1].Timestamp
+	configs["StartTime"] = windowStart * 1000
+	configs["EndTime"] = windowEnd * 1000
+
+	rateMap := map[string]interface{}{}
+	for k, series := range l.steadyStateSeries() {
+		if len(series) != len(datapoints) {
+			continue
+		}
+		windowRates := make([]float64, 0, to-from)
+		for _, dp := range series[from:to] {
+			windowRates = append(windowRates, dp.MultiValues["rate"])
+		}
+		rateMap[k] = meanOf(windowRates)
+	}
+	configs["OverallRates"] = rateMap
+
+	l.perSecondHistogramsMutex.RLock()
+	defer l.perSecondHistogramsMutex.RUnlock()
+	quantiles := map[string]interface{}{}
+	if hist := l.steadyStateHistogram(l.perSecondHistograms, l.perSecondErrorHistograms, windowStart, windowEnd); hist != nil {
+		_, quantiles[allCommandsKey] = l.generateQuantileMap(hist)
+	}
+	for label, perSecond := range l.perSecondLabelHistograms {
+		if hist := l.steadyStateHistogram(perSecond, l.perSecondErrorLabelHistograms[label], windowStart, windowEnd); hist != nil {
+			_, quantiles[label] = l.generateQuantileMap(hist)
+		}
+	}
+	configs["OverallQuantiles"] = quantiles
+	return configs
+}
+
+// steadyStateHistogram merges the per-second histograms of the seconds in
+// [from, to), leaving out the failed commands of perSecondErrors unless
+// --latency-include-errors, or returns nil when there are none.
+func (l *BenchmarkRunner) steadyStateHistogram(perSecond, perSecondErrors map[uint64]*hdrhistogram.Histogram, from, to int64) *hdrhistogram.Histogram {
+	merged := l.mergeSeconds(perSecond, from, to)
+	if merged == nil || l.latencyIncludeErrors {
+		return merged
+	}
+	errors := l.mergeSeconds(perSecondErrors, from, to)
+	if errors == nil {
+		return merged
+	}
+	// both have the layout of hdrhistogram.New(1, l.maxLatency(), 3), so their
+	// counts line up
+	snapshot := merged.Export()
+	for i, n := range errors.Export().Counts {
+		snapshot.Counts[i] -= n
+	}
+	return hdrhistogram.Import(snapshot)
+}
+
+// recordSecondError records the latency of a failed command in the
+// per-second error histograms of its second and label. Callers hold
+// perSecondHistogramsMutex.
+func (l *BenchmarkRunner) recordSecondError(ts uint64, labelKey string, latency int64) {
+	if l.perSecondErrorHistograms == nil {
+		l.perSecondErrorHistograms = make(map[uint64]*hdrhistogram.Histogram)
+		l.perSecondErrorLabelHistograms = make(map[string]map[uint64]*hdrhistogram.Histogram)
+	}
+	if _, exist := l.perSecondErrorHistograms[ts]; !exist {
+		l.perSecondErrorHistograms[ts] = hdrhistogram.New(1, l.maxLatency(), 3)
+	}
+	_ = l.perSecondErrorHistograms[ts].RecordValue(latency)
+	if labelKey == "" {
+		return
+	}
+	if _, exist := l.perSecondErrorLabelHistograms[labelKey]; !exist {
+		l.perSecondErrorLabelHistograms[labelKey] = make(map[uint64]*hdrhistogram.Histogram)
+	}
+	if _, exist := l.perSecondErrorLabelHistograms[labelKey][ts]; !exist {
+		l.perSecondErrorLabelHistograms[labelKey][ts] = hdrhistogram.New(1, l.maxLatency(), 3)
+	}
+	_ = l.perSecondErrorLabelHistograms[labelKey][ts].RecordValue(latency)
+}
+
+// mergeSeconds merges the per-second histograms of the seconds in [from, to),
+// or returns nil when there are none.
+func (l *BenchmarkRunner) mergeSeconds(perSecond map[uint64]*hdrhistogram.Histogram, from, to int64) *hdrhistogram.Histogram {
+	var merged *hdrhistogram.Histogram
+	for ts, hist := range perSecond {
+		if int64(ts) < from || int64(ts) >= to {
+			continue
+		}
+		if merged == nil {
+			merged = hdrhistogram.New(1, l.maxLatency(), 3)
+		}
+		merged.Merge(hist)
+	}
+	return merged
+}
+
+// steadyStateSummary prints the steady-state window and its stability, or why
+// none was found.
+func (l *BenchmarkRunner) steadyStateSummary() {
+	steady := l.testResult.SteadyState
+	if steady == nil {
+		return
+	}
+	tailKey := steady["TailQuantile"].(string)
+	if !steady["Detected"].(bool) {
+		log.Printf("\tNo steady state detected: throughput CV %.1f%% over %d of %d reporting periods (whole run %.1f%%)\n",
+			steady["ThroughputCV"].(float64)*100, steady["Periods"], steady["TotalPeriods"], steady["WholeRunThroughputCV"].(float64)*100)
+		return
+	}
+	log.Printf("\tSteady state: %d of %d reporting periods (%d warm-up, %d ramp-down), throughput CV %.1f%% (whole run %.1f%%), all commands %s CV %.1f%% (whole run %.1f%%)\n",
+		steady["Periods"], steady["TotalPeriods"], steady["WarmupPeriods"], steady["RampDownPeriods"],
+		steady["ThroughputCV"].(float64)*100, steady["WholeRunThroughputCV"].(float64)*100,
+		tailKey, steady["TailCV"].(float64)*100, steady["WholeRunTailCV"].(float64)*100)
+	rate := steady["OverallRates"].(map[string]interface{})["overallOpsRate"]
+	if all, ok := steady["OverallQuantiles"].(map[string]interface{})[allCommandsKey].(map[string]float64); ok {
+		log.Printf("\t- Steady state %.0f ops/sec\t\t%s lat %0.3f ms\n", rate, tailKey, all[tailKey])
+	}
+}
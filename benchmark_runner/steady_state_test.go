@@ -0,0 +1,120 @@
+package benchmark_runner
+
+import (
+	"testing"
+	"time"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+)
+
+func TestSteadyStateWindowTrimsWarmupAndRampDown(t *testing.T) {
+	rates := []float64{100, 500, 1000, 1000, 1010, 990, 1000, 1005, 995, 300}
+	if from, to := steadyStateWindow(rates); from != 2 || to != 9 {
+		t.Errorf("steadyStateWindow = [%d, %d), want [2, 9)", from, to)
+	}
+	// plain noise is not trimmed
+	rates = []float64{1000, 1030, 980, 1010, 990, 1020, 970, 1000}
+	if from, to := steadyStateWindow(rates); from != 0 || to != len(rates) {
+		t.Errorf("steadyStateWindow = [%d, %d), want the whole run", from, to)
+	}
+}
+
+func TestGetSteadyStateMap(t *testing.T) {
+	l := newTestRunner()
+	l.start = time.Unix(1000, 0)
+	rates := []float64{100, 500, 1000, 1000, 1010, 990, 1000, 1005, 995, 300}
+	for i, rate := range rates {
+		dp := NewDataPoint(int64(1001 + i))
+		dp.AddValue("rate", rate)
+		dp.AddValue("q99", 2)
+		l.totalTs = append(l.totalTs, *dp)
+		l.writeTs = append(l.writeTs, *dp)
+		// a slow warm-up second and fast steady ones
+		latency := int64(1000)
+		if i < 2 {
+			latency = 50000
+		}
+		hist := hdrhistogram.New(1, l.maxLatency(), 3)
+		_ = hist.RecordValue(latency)
+		l.perSecondHistograms[uint64(1000+i)] = hist
+	}
+
+	steady := l.GetSteadyStateMap()
+	if steady["Detected"] != true || steady["WarmupPeriods"] != 2 || steady["RampDownPeriods"] != 1 || steady["Periods"] != 7 {
+		t.Fatalf("steady state = %v", steady)
+	}
+	if steady["StartTime"] != int64(1002000) || steady["EndTime"] != int64(1009000) {
+		t.Errorf("window = %v - %v, want 1002000 - 1009000", steady["StartTime"], steady["EndTime"])
+	}
+	if cv := steady["ThroughputCV"].(float64); cv > 0.01 {
+		t.Errorf("ThroughputCV = %v, want below 1%%", cv)
+	}
+	if cv := steady["WholeRunThroughputCV"].(float64); cv < 0.3 {
+		t.Errorf("WholeRunThroughputCV = %v, want the warm-up and ramp-down to show", cv)
+	}
+	rate := steady["OverallRates"].(map[string]interface{})["overallOpsRate"].(float64)
+	if rate < 990 || rate > 1010 {
+		t.Errorf("steady state overallOpsRate = %v, want about 1000", rate)
+	}
+	// only the steady seconds' latencies, not the slow warm-up's
+	all := steady["OverallQuantiles"].(map[string]interface{})[allCommandsKey].(map[string]float64)
+	if all["q100"] < 0.99 || all["q100"] > 1.01 {
+		t.Errorf("steady state q100 = %v ms, want 1", all["q100"])
+	}
+}
+
+// The steady-state quantiles cover the same commands as the whole run's
+// OverallQuantiles: fast failed commands do not drag them down by default.
+func TestGetSteadyStateMapLeavesOutErrors(t *testing.T) {
+	l := newTestRunner()
+	l.start = time.Unix(1000, 0)
+	for i := 0; i < 8; i++ {
+		dp := NewDataPoint(int64(1001 + i))
+		dp.AddValue("rate", 1000)
+		l.totalTs = append(l.totalTs, *dp)
+		for j := 0; j < 10; j++ {
+			// slow successes, more fast OOM-like rejections
+			ok := NewCmdStat([]byte("WRITE"), []byte("W1"), 10000, false, false, 0, 10)
+			ok.SetStartTs(uint64(1000 + i))
+			l.recordCmdStat(*ok)
+			for k := 0; k < 3; k++ {
+				failed := NewCmdStat([]byte("WRITE"), []byte("W1"), 10, true, false, 0, 10)
+				failed.SetStartTs(uint64(1000 + i))
+				l.recordCmdStat(*failed)
+			}
+		}
+	}
+	q50 := func(key string) float64 {
+		steady := l.GetSteadyStateMap()
+		if steady["Detected"] != true {
+			t.Fatalf("steady state = %v", steady)
+		}
+		return steady["OverallQuantiles"].(map[string]interface{})[key].(map[string]float64)["q50"]
+	}
+	for _, key := range []string{allCommandsKey, "write"} {
+		whole := l.GetOverallQuantiles()[key].(map[string]float64)["q50"]
+		if q := q50(key); q < 9.9 || q > 10.1 || q != whole {
+			t.Errorf("steady state %s q50 = %v ms, want the successes' 10 like the whole run's %v", key, q, whole)
+		}
+	}
+	l.latencyIncludeErrors = true
+	if q := q50("write"); q > 0.011 {
+		t.Errorf("steady state write q50 including errors = %v ms, want the errors' 0.01", q)
+	}
+}
+
+func TestGetSteadyStateMapNotDetected(t *testing.T) {
+	l := newTestRunner()
+	for i, rate := range []float64{1000, 200, 1500, 400, 1200, 100} {
+		dp := NewDataPoint(int64(1001 + i))
+		dp.AddValue("rate", rate)
+		l.totalTs = append(l.totalTs, *dp)
+	}
+	steady := l.GetSteadyStateMap()
+	if steady["Detected"] != false || steady["OverallRates"] != nil {
+		t.Errorf("steady state = %v, want none detected", steady)
+	}
+	if newTestRunner().GetSteadyStateMap() != nil {
+		t.Error("expected no SteadyState without reporting periods")
+	}
+}
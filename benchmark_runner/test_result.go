@@ -28,8 +28,17 @@ type TestResult struct {
 	ResultFormatVersion string `json:"ResultFormatVersion"`
 	Limit               uint64 `json:"Limit"`
 	Workers             uint   `json:"Workers"`
+	InputReaders        uint   `json:"InputReaders"`
 	MaxRps              uint64 `json:"MaxRps"`
 
+	// Latency units: LatencyUnit of the recorded latencies, and so of the
+	// encoded histograms (us or ns), QuantilesUnit of the quantile values (ms)
+	LatencyUnit   string `json:"LatencyUnit"`
+	QuantilesUnit string `json:"QuantilesUnit"`
+	// Percentiles maps each OverallQuantiles and TimeSeries quantile key to its
+	// --percentiles value, e.g. q999 to 99.9
+	Percentiles map[string]float64 `json:"Percentiles,omitempty"`
+
 	// DB Spefic Configs
 	DBSpecificConfigs map[string]interface{} `json:"DBSpecificConfigs"`
 
@@ -48,8 +57,48 @@ type TestResult struct {
 	// Overall Quantiles
 	OverallQuantiles map[string]interface{} `json:"OverallQuantiles"`
 
+	// Steady-state window detected from the reporting periods, with its rates,
+	// quantiles and stability next to the whole run's. Its OverallQuantiles
+	// cover the same commands as the whole run's; TailCV and WholeRunTailCV
+	// are over all commands, failed ones included
+	SteadyState map[string]interface{} `json:"SteadyState,omitempty"`
+
 	// Time-Series
 	TimeSeries map[string]interface{} `json:"TimeSeries"`
 
 	PerSecondEncodedHistograms map[uint64]string `json:"PerSecondEncodedHistograms"`
+
+	// PerSecondEncodedHistograms per label, e.g. "write" or "read"
+	PerSecondEncodedLabelHistograms map[string]map[uint64]string `json:"PerSecondEncodedLabelHistograms,omitempty"`
+
+	// Commands recorded per client connection id
+	ConnectionCommandCounts map[uint32]uint64 `json:"ConnectionCommandCounts"`
+
+	// --per-client-stats breakdown per worker number and per connection id
+	WorkerStats     map[int]interface{}    `json:"WorkerStats,omitempty"`
+	ConnectionStats map[uint32]interface{} `json:"ConnectionStats,omitempty"`
+
+	// Reply size and results count distributions per query id, only with
+	// captured replies
+	ReplyStats map[string]interface{} `json:"ReplyStats,omitempty"`
+
+	// Pipeline round-trip latencies and sizes, and the amortized per-command
+	// latency quantiles
+	PipelineStats map[string]interface{} `json:"PipelineStats,omitempty"`
+
+	// The client's own CPU usage, goroutines, heap and GC pauses over the run
+	ClientRuntimeStats map[string]interface{} `json:"ClientRuntimeStats,omitempty"`
+
+	// Server metrics at the start and end of the run and their delta, when the
+	// benchmark samples its server
+	ServerStats map[string]interface{} `json:"ServerStats,omitempty"`
+
+	// Aggregated out-of-band query profiles (e.g. FT.PROFILE) per query id
+	QueryProfiles map[string]interface{} `json:"QueryProfiles,omitempty"`
+
+	// Server side diagnostics captured after the run (e.g. SLOWLOG, LATENCY)
+	ServerDiagnostics map[string]interface{} `json:"ServerDiagnostics,omitempty"`
+
+	// Input read-speed report, only for --do-benchmark=false runs
+	InputReadStats map[string]interface{} `json:"InputReadStats,omitempty"`
 }
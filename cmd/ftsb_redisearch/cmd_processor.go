@@ -30,43 +30,50 @@ import (
 // begins with it cannot be represented and will be decoded (or rejected).
 const binaryArgMarker = "__b64__"
 
-// decodeBinaryArgs base64-decodes every `__b64__`-marked argument in place and
-// returns `shrink`, the total number of input bytes removed by decoding (base64
-// expands the payload ~4/3 and the 7-byte marker is stripped). The caller
-// subtracts `shrink` from its raw-row byte count so the reported wire-byte
-// throughput reflects the decoded bytes actually sent to Redis, not the larger
-// base64 text.
+// decodeBinaryArgs base64-decodes every `__b64__`-marked argument in place, so
+// the raw bytes are what is sent to Redis and what respRequestLen counts as the
+// command's TX bytes.
 //
 // A marked argument that fails to decode — or that decodes to zero bytes —
 // means the input file is corrupt: silently passing it through would ingest
 // garbage into Redis. The error is *returned* (not fatal) so the caller can
 // honor -continue-on-error, consistent with every other error path here.
-func decodeBinaryArgs(args []string) (shrink uint64, err error) {
+func decodeBinaryArgs(args []string) error {
 	for i, arg := range args {
 		if strings.HasPrefix(arg, binaryArgMarker) {
 			decoded, decErr := base64.StdEncoding.DecodeString(arg[len(binaryArgMarker):])
 			if decErr != nil {
 				// i indexes into args (argsStr[4:]); +4 gives the CSV column.
-				return 0, fmt.Errorf("failed to base64-decode binary argument at CSV field %d: %w", i+4, decErr)
+				return fmt.Errorf("failed to base64-decode binary argument at CSV field %d: %w", i+4, decErr)
 			}
 			if len(decoded) == 0 {
-				return 0, fmt.Errorf("empty base64 binary argument at CSV field %d: %q", i+4, arg)
+				return fmt.Errorf("empty base64 binary argument at CSV field %d: %q", i+4, arg)
 			}
-			shrink += uint64(len(arg) - len(decoded))
 			// Go strings carry arbitrary bytes; radix sends them verbatim.
 			args[i] = string(decoded)
 		}
 	}
-	return shrink, nil
+	return nil
 }
 
 type processor struct {
-	rows           chan string
-	cmdChan        chan benchmark_runner.Stat
-	wg             *sync.WaitGroup
-	vanillaClient  *radix.Pool
-	vanillaCluster *radix.Cluster
-	clusterTopo    radix.ClusterTopo
+	rows    chan string
+	cmdChan chan benchmark_runner.Stat
+	wg      *sync.WaitGroup
+	// conns are the connections this worker drives; ProcessBatch runs one
+	// connectionProcessor per connection, all draining the same rows.
+	conns []*redisConn
+	// conn is the connection a connectionProcessor sends on (nil on the
+	// worker's own processor).
+	conn *redisConn
+}
+
+// connId returns the id of the connection this processor sends on.
+func (p *processor) connId() uint32 {
+	if p.conn == nil {
+		return 0
+	}
+	return p.conn.id
 }
 
 // getDialOpts returns the common dial options for connections
@@ -87,62 +94,17 @@ func getCustomConnFunc() func(network, addr string) (radix.Conn, error) {
 	}
 }
 
-// createPool creates a new radix.Pool with the standard configuration
+// createPool creates a new radix.Pool with the standard configuration. The pool
+// holds exactly one connection: OnEmptyWait stops radix from opening overflow
+// connections when workers share it (--clients below --workers).
 func createPool() (*radix.Pool, error) {
 	customConnFunc := getCustomConnFunc()
-	return radix.NewPool("tcp", host, 1, radix.PoolConnFunc(customConnFunc), radix.PoolPipelineWindow(0, 0), radix.PoolPingInterval(1*time.Hour))
-}
-
-// reconnectPool closes the existing pool (if any) and creates a new one.
-// Returns the new pool or logs a fatal error if reconnection fails.
-func (p *processor) reconnectPool() {
-	if p.vanillaClient != nil {
-		p.vanillaClient.Close()
-	}
-	var err error
-	p.vanillaClient, err = createPool()
-	if err != nil {
-		if continueOnErr {
-			log.Printf("Error reconnecting to Redis: %v", err)
-		} else {
-			log.Fatalf("Fatal error reconnecting to Redis: %v", err)
-		}
-	} else {
-		log.Println("Successfully reconnected to Redis after error")
-	}
+	return radix.NewPool("tcp", host, 1, radix.PoolConnFunc(customConnFunc), radix.PoolPipelineWindow(0, 0), radix.PoolPingInterval(1*time.Hour), radix.PoolOnEmptyWait())
 }
 
 func (p *processor) Init(workerNumber int, _ bool, totalWorkers int) {
-	var err error = nil
-
-	customConnFunc := getCustomConnFunc()
-
-	// this cluster will use the ClientFunc to create a pool to each node in the
-	// cluster.
-	poolFunc := func(network, addr string) (radix.Client, error) {
-		return radix.NewPool(network, addr, int(1), radix.PoolConnFunc(customConnFunc), radix.PoolPipelineWindow(0, 0))
-	}
-
-	if clusterMode {
-
-		// We dont want the cluster to sync during the benchmark so we increase the sync time to a large value ( and do the sync CLUSTER SLOTS ) prior
-		p.vanillaCluster, err = radix.NewCluster([]string{host}, radix.ClusterPoolFunc(poolFunc), radix.ClusterSyncEvery(1*time.Hour))
-		if err != nil {
-			log.Fatalf("Error preparing for redisearch ingestion, while creating new cluster connection. error = %v", err)
-		}
-		err = p.vanillaCluster.Sync()
-		if err != nil {
-			log.Fatalf("Error retrieving cluster topology. error = %v", err)
-		}
-		p.clusterTopo = p.vanillaCluster.Topo()
-	} else {
-		// add randomness on ping interval
-		//pingInterval := (20+rand.Intn(10))*1000000000
-		// We dont want PING to be issed from 5 to 5 seconds given that we know the connection is alive on the benchmark
-		p.vanillaClient, err = createPool()
-		if err != nil {
-			log.Fatalf("Error preparing for redisearch ingestion, while creating new pool. error = %v", err)
-		}
+	for _, id := range workerConnIds(workerNumber, totalWorkers) {
+		p.conns = append(p.conns, acquireConn(id))
 	}
 }
 
@@ -155,7 +117,7 @@ func connectionProcessor(p *processor, rateLimiter *rate.Limiter, useRateLimiter
 	if !clusterMode {
 		pendingSlots = append(pendingSlots, make([]pendingCmd, 0, 0))
 	} else {
-		for _, ClusterNode := range p.clusterTopo {
+		for _, ClusterNode := range p.conn.topo {
 			for _, slot := range ClusterNode.Slots {
 				clusterSlots = append(clusterSlots, slot)
 				pendingSlots = append(pendingSlots, make([]pendingCmd, 0, 0))
@@ -170,7 +132,43 @@ func connectionProcessor(p *processor, rateLimiter *rate.Limiter, useRateLimiter
 		slotP = rand.Intn(clusterAddrLen) // NOSONAR
 	}
 
-	for row := range p.rows {
+	// flushSlot sends whatever is buffered for slot i, if anything, on the
+	// client that owns it.
+	flushSlot := func(i int) {
+		if len(pendingSlots[i]) == 0 {
+			return
+		}
+		if !clusterMode {
+			var hadError bool
+			client := p.conn.client()
+			pendingSlots[i], hadError = flushPending(p, client, pendingSlots[i])
+			if hadError && continueOnErr {
+				p.conn.reconnect(client)
+			}
+		} else {
+			client, _ := p.conn.cluster.Client(clusterAddr[i])
+			pendingSlots[i], _ = flushPending(p, client, pendingSlots[i])
+		}
+	}
+
+	var linger lingerTimer
+	defer linger.stop()
+	for {
+		row, more, expired := linger.next(p.rows, pendingSlots)
+		if expired {
+			// no row came in before the oldest buffered command waited
+			// --pipeline-max-linger: flush the windows that are due
+			now := time.Now()
+			for i := range pendingSlots {
+				if deadline, ok := lingerDeadline(pendingSlots[i]); ok && !deadline.After(now) {
+					flushSlot(i)
+				}
+			}
+			continue
+		}
+		if !more {
+			break
+		}
 		cmdType, cmdQueryId, keyPos, cmd, key, clusterSlot, docFields, bytelen, err := preProcessCmd(row)
 		if err != nil {
 			// Honor -continue-on-error like every other error path: skip the
@@ -201,19 +199,35 @@ func connectionProcessor(p *processor, rateLimiter *rate.Limiter, useRateLimiter
 		}
 		if useRateLimiter {
 			r := rateLimiter.ReserveN(time.Now(), int(1))
-			time.Sleep(r.Delay())
+			sendAt := time.Now().Add(r.Delay())
+			if pipelineMaxLinger > 0 {
+				// Don't let an unfilled window sit behind the rate limiter: flush
+				// every window whose linger deadline falls before our send slot.
+				for i := range pendingSlots {
+					if deadline, ok := lingerDeadline(pendingSlots[i]); ok && deadline.Before(sendAt) {
+						time.Sleep(time.Until(deadline))
+						flushSlot(i)
+					}
+				}
+			}
+			time.Sleep(time.Until(sendAt))
+		}
+		if profiler != nil && profiler.sample(cmdType, cmdQueryId, cmd, docFields) {
+			// sent as FT.PROFILE by the profiler instead
+			continue
 		}
 		if !clusterMode {
 			var hadError bool
-			pendingSlots[slotP], hadError = sendFlatCmd(p, p.vanillaClient, cmdType, cmdQueryId, cmd, docFields, bytelen, pendingSlots[slotP])
+			client := p.conn.client()
+			pendingSlots[slotP], hadError = sendFlatCmd(p, client, cmdType, cmdQueryId, cmd, docFields, bytelen, pendingSlots[slotP])
 			if hadError && continueOnErr {
 				// Reconnect to get a fresh connection after an error.
 				// This prevents hanging on a broken/half-closed connection
 				// (e.g., after OOM errors where the server may close the connection).
-				p.reconnectPool()
+				p.conn.reconnect(client)
 			}
 		} else {
-			client, _ := p.vanillaCluster.Client(clusterAddr[slotP])
+			client, _ := p.conn.cluster.Client(clusterAddr[slotP])
 			pendingSlots[slotP], _ = sendFlatCmd(p, client, cmdType, cmdQueryId, cmd, docFields, bytelen, pendingSlots[slotP])
 		}
 	}
@@ -222,51 +236,40 @@ func connectionProcessor(p *processor, rateLimiter *rate.Limiter, useRateLimiter
 	// (rows % pipeline) buffered commands in each slot are never sent to Redis
 	// or counted -- silent data loss whenever pipeline does not divide the row
 	// count. flushPending sends whatever is buffered regardless of pipeline size.
-	if !clusterMode {
-		if len(pendingSlots[0]) > 0 {
-			var hadError bool
-			pendingSlots[0], hadError = flushPending(p, p.vanillaClient, pendingSlots[0])
-			if hadError && continueOnErr {
-				p.reconnectPool()
-			}
-		}
-	} else {
-		for i := range pendingSlots {
-			if len(pendingSlots[i]) > 0 {
-				client, _ := p.vanillaCluster.Client(clusterAddr[i])
-				pendingSlots[i], _ = flushPending(p, client, pendingSlots[i])
-			}
-		}
+	for i := range pendingSlots {
+		flushSlot(i)
 	}
 	p.wg.Done()
 }
 
-// getRxLen approximates the reply bytes received for a command by sizing the
-// value radix unmarshalled into the receiver: bulk strings (string/[]byte),
-// arrays ([]interface{} / []string, summed recursively), and integers (decimal
-// digit count). A *interface{} receiver is dereferenced; nil/unknown → 0.
-func getRxLen(v interface{}) (res uint64) {
-	switch x := v.(type) {
-	case *interface{}:
-		if x != nil {
-			res = getRxLen(*x)
-		}
-	case string:
-		res = uint64(len(x))
-	case []byte:
-		res = uint64(len(x))
-	case []string:
-		for _, i := range x {
-			res += uint64(len(i))
-		}
-	case []interface{}:
-		for _, e := range x {
-			res += getRxLen(e)
+// replyResultCount returns the total results count of a captured FT.SEARCH,
+// FT.AGGREGATE or FT.CURSOR READ reply: the leading integer of the reply, or
+// of its first element for the [results, cursor] replies of cursor reads.
+// Only those replies are decoded.
+func replyResultCount(redisCmd string, reply interface{}) (uint64, bool) {
+	switch strings.ToUpper(redisCmd) {
+	case "FT.SEARCH", "FT.AGGREGATE", "FT.CURSOR":
+	default:
+		return 0, false
+	}
+	if captured, ok := reply.(*capturedReply); ok {
+		reply = captured.value()
+	}
+	arr, ok := reply.([]interface{})
+	if !ok || len(arr) == 0 {
+		return 0, false
+	}
+	if inner, ok := arr[0].([]interface{}); ok {
+		if len(inner) == 0 {
+			return 0, false
 		}
-	case int64:
-		res = uint64(len(strconv.FormatInt(x, 10)))
+		arr = inner
 	}
-	return
+	total, ok := arr[0].(int64)
+	if !ok || total < 0 {
+		return 0, false
+	}
+	return uint64(total), true
 }
 
 // pendingCmd is a single command buffered for the current pipeline window,
@@ -277,25 +280,26 @@ func getRxLen(v interface{}) (res uint64) {
 // flushing command's values.
 type pendingCmd struct {
 	action     radix.CmdAction
-	reply      *interface{}
+	reply      *capturedReply
 	cmdType    string
 	cmdQueryId string
 	redisCmd   string
 	redisKey   string
 	txBytes    uint64
+	queuedAt   time.Time
 }
 
 func sendFlatCmd(p *processor, client radix.Client, cmdType, cmdQueryId, cmd string, docfields []string, txBytesCount uint64, pending []pendingCmd) ([]pendingCmd, bool) {
 	// By default use a nil receiver: radix reads and DISCARDS the reply (no
 	// allocation, no reflection) so the measured latency isn't inflated by
 	// client-side unmarshalling -- which is significant for large FT.SEARCH /
-	// FT.AGGREGATE replies (issue #117). --capture-replies opts into decoding the
-	// reply so getRxLen can populate RxBytes. Command errors are surfaced by radix
-	// regardless of the receiver.
-	var reply *interface{}
+	// FT.AGGREGATE replies (issue #117). --capture-replies opts into keeping the
+	// raw reply so RxBytes gets its exact size. Command errors are surfaced by
+	// radix regardless of the receiver.
+	var reply *capturedReply
 	var rcv interface{} // nil interface -> discard
 	if captureReplies {
-		reply = new(interface{})
+		reply = new(capturedReply)
 		rcv = reply
 	}
 	key := ""
@@ -310,39 +314,103 @@ func sendFlatCmd(p *processor, client radix.Client, cmdType, cmdQueryId, cmd str
 		redisCmd:   cmd,
 		redisKey:   key,
 		txBytes:    txBytesCount,
+		queuedAt:   time.Now(),
 	})
 	return sendIfRequired(p, client, pending)
 }
 
 // sendIfRequired flushes the buffered pipeline window once it reaches `pipeline`
-// commands; otherwise it buffers and returns. The trailing partial window (fewer
+// commands, or once its oldest command has waited --pipeline-max-linger (when
+// set; without incoming rows, connectionProcessor's lingerTimer flushes it);
+// otherwise it buffers and returns. The trailing partial window (fewer
 // than `pipeline` commands, e.g. `rows % pipeline` at end of input) is flushed by
 // the caller via flushPending -- see connectionProcessor -- so those commands are
 // never silently dropped.
 func sendIfRequired(p *processor, client radix.Client, pending []pendingCmd) ([]pendingCmd, bool) {
 	if len(pending) < pipeline {
-		return pending, false
+		deadline, ok := lingerDeadline(pending)
+		if !ok || time.Now().Before(deadline) {
+			return pending, false
+		}
 	}
 	return flushPending(p, client, pending)
 }
 
-// flooredMicros converts a duration to whole microseconds with a 1us floor: a
-// real network round-trip is never 0us, so a measured 0 only reflects
-// sub-microsecond timer resolution and would otherwise record a physically
-// impossible 0us latency.
-func flooredMicros(d time.Duration) uint64 {
-	us := uint64(d.Microseconds())
-	if us == 0 {
+// lingerDeadline returns the time by which the buffered window must be flushed
+// under --pipeline-max-linger: the oldest buffered command's queue time plus
+// the linger. ok is false when the linger is disabled or nothing is buffered.
+func lingerDeadline(pending []pendingCmd) (deadline time.Time, ok bool) {
+	if pipelineMaxLinger <= 0 || len(pending) == 0 {
+		return
+	}
+	return pending[0].queuedAt.Add(pipelineMaxLinger), true
+}
+
+// lingerTimer fires at the earliest --pipeline-max-linger deadline of a
+// connectionProcessor's buffered windows, so a partial window is flushed on
+// time while the worker waits for rows, not only when the next row arrives.
+// ProcessBatch currently hands a whole batch over at once and closes rows,
+// which flushes the trailing window; the timer keeps the linger bound however
+// rows are fed.
+type lingerTimer struct {
+	timer *time.Timer
+	armed time.Time // deadline the timer is set to, zero when not set
+}
+
+// next returns the next row (more is false once rows is closed), or expired
+// when the earliest linger deadline of pendingSlots passes first.
+func (t *lingerTimer) next(rows <-chan string, pendingSlots [][]pendingCmd) (row string, more, expired bool) {
+	var fire <-chan time.Time
+	var earliest time.Time
+	for _, pending := range pendingSlots {
+		if deadline, ok := lingerDeadline(pending); ok && (earliest.IsZero() || deadline.Before(earliest)) {
+			earliest = deadline
+		}
+	}
+	if !earliest.IsZero() {
+		if !earliest.Equal(t.armed) {
+			if t.timer == nil {
+				t.timer = time.NewTimer(time.Until(earliest))
+			} else {
+				// go >= 1.23 timers drop a stale fire on Reset
+				t.timer.Reset(time.Until(earliest))
+			}
+			t.armed = earliest
+		}
+		fire = t.timer.C
+	}
+	select {
+	case row, more = <-rows:
+		return row, more, false
+	case <-fire:
+		t.armed = time.Time{}
+		return "", true, true
+	}
+}
+
+func (t *lingerTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// flooredLatency converts a duration to whole latency units (see
+// --latency-unit) with a floor of 1: a real network round-trip is never 0, so
+// a measured 0 only reflects the timer resolution and would otherwise record a
+// physically impossible 0 latency.
+func flooredLatency(d, unit time.Duration) uint64 {
+	v := uint64(d / unit)
+	if v == 0 {
 		return 1
 	}
-	return us
+	return v
 }
 
 // logFlushError logs a pipeline-flush failure, honoring -continue-on-error
-// (log-and-continue vs. fatal), and returns whether it was an i/o timeout. A
+// (log-and-continue vs. fatal), and returns its error class. A
 // flush may mix command types, so the first buffered command is used as the
 // summary label. Split out of flushPending to keep that function simple.
-func logFlushError(pending []pendingCmd, err error) bool {
+func logFlushError(pending []pendingCmd, err error) string {
 	rep := pending[0]
 	isRead := rep.cmdType == "READ" || rep.cmdType == "READ_CURSOR"
 	// Preserve the historical prefixes: "Fatal error with" on the aborting path
@@ -358,22 +426,23 @@ func logFlushError(pending []pendingCmd, err error) bool {
 	} else {
 		logf("%s %s command: %s %s (%d command(s) in pipeline), error: %v", prefix, rep.cmdType, rep.redisCmd, rep.redisKey, len(pending), err)
 	}
-	if !strings.Contains(err.Error(), "i/o timeout") {
-		return false
+	class := classifyError(err)
+	if class != errorClassTimeout {
+		return class
 	}
 	if isRead {
 		log.Printf("Timeout occurred with %d command(s) in pipeline, continuing execution...", len(pending))
 	} else {
 		log.Printf("Timeout occurred with %s command: %s %s (%d command(s) in pipeline), continuing execution...", rep.cmdType, rep.redisCmd, rep.redisKey, len(pending))
 	}
-	return true
+	return class
 }
 
 // flushPending sends the buffered commands (as a pipeline when >1), records one
-// stat per command -- each with its own sent/received bytes and labels, plus the
-// shared batch send->reply latency -- and returns the emptied buffer (reusing the
-// backing array to avoid churn on the hot path). Callers must guard against an
-// empty buffer.
+// stat per command -- each with its own sent/received bytes and labels, plus
+// the shared batch send->reply latency and pipeline size -- and returns the
+// emptied buffer (reusing the backing array to avoid churn on the hot path).
+// Callers must guard against an empty buffer.
 func flushPending(p *processor, client radix.Client, pending []pendingCmd) ([]pendingCmd, bool) {
 	hadError := false
 
@@ -393,26 +462,39 @@ func flushPending(p *processor, client radix.Client, pending []pendingCmd) ([]pe
 	sendT := time.Now()
 	err := client.Do(action)
 	endT := time.Now()
-	isTimeout := false
+	errorClass := ""
 	if err != nil {
 		hadError = true
-		isTimeout = logFlushError(pending, err)
+		errorClass = logFlushError(pending, err)
 	}
+	isTimeout := errorClass == errorClassTimeout
 
 	// A pipeline is one client round-trip for the whole batch, so attribute the
 	// same send->reply latency to every command in it. Measuring from each
 	// command's buffer time instead would fold in client-side queueing (the first
 	// command would absorb the whole window-fill wait). For pipeline=1 sendT is
-	// effectively the command's send time, so latency is unchanged. Floor to 1us:
-	// a real network round-trip is never 0us, so a 0 only reflects sub-microsecond
-	// timer resolution.
-	took := flooredMicros(endT.Sub(sendT))
+	// effectively the command's send time, so latency is unchanged. Floor to one
+	// unit: a real network round-trip is never 0, so a 0 only reflects the timer
+	// resolution.
+	took := flooredLatency(endT.Sub(sendT), loader.LatencyUnit())
 	for i := range pending {
 		pc := &pending[i]
 		// AddEntry takes (..., rx, tx): received bytes, then sent bytes. Each
 		// command records its OWN counts and labels.
-		rxBytesCount := getRxLen(pc.reply)
+		rxBytesCount := uint64(0)
+		if pc.reply != nil {
+			rxBytesCount = pc.reply.wireLen()
+		}
 		stat := benchmark_runner.NewStat().AddEntry([]byte(pc.cmdType), []byte(pc.cmdQueryId), uint64(sendT.Unix()), took, hadError, isTimeout, rxBytesCount, pc.txBytes)
+		stat.CmdStats()[0].SetConnId(p.connId())
+		stat.CmdStats()[0].SetErrorClass(errorClass)
+		stat.CmdStats()[0].SetPipeline(uint32(len(pending)), i == 0)
+		if pc.reply != nil {
+			stat.CmdStats()[0].SetReplyCaptured(true)
+			if results, ok := replyResultCount(pc.redisCmd, pc.reply); ok {
+				stat.CmdStats()[0].SetResults(results)
+			}
+		}
 		p.cmdChan <- *stat
 	}
 
@@ -430,8 +512,10 @@ func (p *processor) ProcessBatch(b benchmark_runner.Batch, doLoad bool, rateLimi
 		p.cmdChan = make(chan benchmark_runner.Stat, buflen)
 		p.wg = &sync.WaitGroup{}
 		p.rows = make(chan string, buflen)
-		p.wg.Add(1)
-		go connectionProcessor(p, rateLimiter, useRateLimiter)
+		p.wg.Add(len(p.conns))
+		for _, conn := range p.conns {
+			go connectionProcessor(&processor{rows: p.rows, cmdChan: p.cmdChan, wg: p.wg, conn: conn}, rateLimiter, useRateLimiter)
+		}
 		for _, row := range events.rows {
 			p.rows <- row
 		}
@@ -443,18 +527,37 @@ func (p *processor) ProcessBatch(b benchmark_runner.Batch, doLoad bool, rateLimi
 		for cmdStat := range p.cmdChan {
 			outstat.Merge(cmdStat)
 		}
+	} else {
+		parseRows(events.rows, &outstat)
 	}
 	events.rows = events.rows[:0]
 	ePool.Put(events)
 	return
 }
 
-func (p *processor) Close(_ bool) {
-	if p.vanillaClient != nil {
-		p.vanillaClient.Close()
+// parseRows runs the per-row client-side work of a real run -- preProcessCmd,
+// including the base64 decoding of marked arguments -- without sending
+// anything, and accounts the rows, their bytes (with the newline) and the parse
+// time in outstat. Backs the --do-benchmark=false input read-speed report.
+func parseRows(rows []string, outstat *benchmark_runner.Stat) {
+	var rowBytes uint64
+	start := time.Now()
+	for _, row := range rows {
+		rowBytes += uint64(len(row)) + 1
+		if _, _, _, _, _, _, _, _, err := preProcessCmd(row); err != nil {
+			if continueOnErr {
+				log.Printf("skipping malformed row: %v", err)
+				continue
+			}
+			log.Fatalf("fatal error preprocessing row: %v", err)
+		}
 	}
-	if p.vanillaCluster != nil {
-		p.vanillaCluster.Close()
+	outstat.AddInputRows(uint64(len(rows)), rowBytes, time.Since(start))
+}
+
+func (p *processor) Close(_ bool) {
+	for _, conn := range p.conns {
+		conn.release()
 	}
 }
 
@@ -476,10 +579,9 @@ func preProcessCmd(row string) (cmdType string, cmdQueryId string, keyPos int, c
 		keyPos = initialPos + 3
 		cmd = argsStr[3]
 		clusterSlot = -1
-		var shrink uint64
 		if len(argsStr) > 4 {
 			args = argsStr[4:]
-			shrink, err = decodeBinaryArgs(args)
+			err = decodeBinaryArgs(args)
 			if err != nil {
 				return
 			}
@@ -494,14 +596,9 @@ func preProcessCmd(row string) (cmdType string, cmdQueryId string, keyPos int, c
 		if initialPos >= 0 {
 			clusterSlot = int(radix.ClusterSlot([]byte(key)))
 		}
-		// bytelen approximates the sent (TX) payload: the row minus the leading
-		// cmdType label, minus the base64 shrink (so it reflects decoded bytes,
-		// not the larger base64 text). It is an application-payload proxy, not
-		// exact RESP wire bytes — it still counts CSV separators / the queryId
-		// and pos columns and omits RESP framing (*N\r\n, per-arg $len\r\n). The
-		// error is negligible for large payloads (e.g. vector blobs) but can be
-		// sizable for many-tiny-arg commands.
-		bytelen = uint64(len(row)) - uint64(len(cmdType)) - shrink
+		// bytelen is the exact sent (TX) size of the RESP-encoded command, with
+		// marked args counted at their decoded size
+		bytelen = respRequestLen(cmd, args)
 	} else {
 		err = fmt.Errorf("input row has %d fields, need at least 4 (cmdType,queryId,pos,cmd): %s", len(argsStr), row)
 	}
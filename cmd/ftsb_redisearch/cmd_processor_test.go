@@ -1,10 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/base64"
 	"strings"
 	"testing"
 
+	"github.com/RediSearch/ftsb/benchmark_runner"
 	radix "github.com/mediocregopher/radix/v3"
 )
 
@@ -20,8 +22,7 @@ var rawBinary = []byte{
 
 func TestDecodeBinaryArgsDecodesMarkedArg(t *testing.T) {
 	args := []string{"doc:1", "vec", binaryArgMarker + base64.StdEncoding.EncodeToString(rawBinary)}
-	shrink, err := decodeBinaryArgs(args)
-	if err != nil {
+	if err := decodeBinaryArgs(args); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if args[2] != string(rawBinary) {
@@ -30,10 +31,6 @@ func TestDecodeBinaryArgsDecodesMarkedArg(t *testing.T) {
 	if len(args[2]) != len(rawBinary) {
 		t.Fatalf("decoded length = %d, want %d", len(args[2]), len(rawBinary))
 	}
-	// 16 bytes -> 24 base64 chars + 7-char marker = 31; shrink = 31 - 16 = 15.
-	if wantShrink := uint64(len(binaryArgMarker) + 24 - len(rawBinary)); shrink != wantShrink {
-		t.Fatalf("shrink = %d, want %d", shrink, wantShrink)
-	}
 }
 
 func TestDecodeBinaryArgsLeavesUnmarkedArgsUntouched(t *testing.T) {
@@ -41,13 +38,9 @@ func TestDecodeBinaryArgsLeavesUnmarkedArgsUntouched(t *testing.T) {
 	// base64-looking token that is NOT marker-prefixed — both pass through.
 	args := []string{"doc:1", "title", "hello __b64 world", "SGVsbG8=", "x__b64__notprefix"}
 	want := []string{"doc:1", "title", "hello __b64 world", "SGVsbG8=", "x__b64__notprefix"}
-	shrink, err := decodeBinaryArgs(args)
-	if err != nil {
+	if err := decodeBinaryArgs(args); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if shrink != 0 {
-		t.Fatalf("shrink = %d, want 0 (no marked args)", shrink)
-	}
 	for i := range args {
 		if args[i] != want[i] {
 			t.Fatalf("unmarked arg %d modified: got %q, want %q", i, args[i], want[i])
@@ -59,7 +52,7 @@ func TestDecodeBinaryArgsLeavesUnmarkedArgsUntouched(t *testing.T) {
 // the process — so the caller can honor -continue-on-error.
 func TestDecodeBinaryArgsRejectsBadBase64(t *testing.T) {
 	args := []string{"doc:1", "vec", binaryArgMarker + "@@not-valid-base64@@"}
-	if _, err := decodeBinaryArgs(args); err == nil {
+	if err := decodeBinaryArgs(args); err == nil {
 		t.Fatal("expected an error for invalid base64, got nil")
 	}
 }
@@ -72,7 +65,7 @@ func TestDecodeBinaryArgsRejectsNonStdEncoding(t *testing.T) {
 		t.Skipf("payload %q has no URL-safe-specific chars; test is vacuous", urlSafe)
 	}
 	args := []string{"vec", binaryArgMarker + urlSafe}
-	if _, err := decodeBinaryArgs(args); err == nil {
+	if err := decodeBinaryArgs(args); err == nil {
 		t.Fatalf("expected StdEncoding to reject URL-safe payload %q", urlSafe)
 	}
 }
@@ -80,7 +73,7 @@ func TestDecodeBinaryArgsRejectsNonStdEncoding(t *testing.T) {
 // An empty payload (`__b64__` with nothing after it) is corrupt for a binary
 // field — it would ship a zero-length blob and silently fail indexing.
 func TestDecodeBinaryArgsRejectsEmptyBlob(t *testing.T) {
-	if _, err := decodeBinaryArgs([]string{binaryArgMarker}); err == nil {
+	if err := decodeBinaryArgs([]string{binaryArgMarker}); err == nil {
 		t.Fatal("expected an error for empty base64 payload, got nil")
 	}
 }
@@ -104,7 +97,8 @@ func TestPreProcessCmdDecodesMarkedFieldInHSET(t *testing.T) {
 }
 
 // The byte counter used for reported wire throughput must reflect the decoded
-// blob actually sent to Redis, not the larger base64 text in the row.
+// blob actually sent to Redis, not the larger base64 text in the row, and count
+// the RESP framing around it.
 func TestPreProcessCmdBytelenReflectsDecodedSize(t *testing.T) {
 	encoded := base64.StdEncoding.EncodeToString(rawBinary) // 16B -> 24 chars
 	field := binaryArgMarker + encoded                      // 7 + 24 = 31 chars
@@ -113,14 +107,11 @@ func TestPreProcessCmdBytelenReflectsDecodedSize(t *testing.T) {
 	if err != nil {
 		t.Fatalf("preProcessCmd returned error: %v", err)
 	}
-	shrink := uint64(len(field) - len(rawBinary)) // 31 - 16 = 15
-	want := uint64(len(row)) - uint64(len("SETUP")) - shrink
+	// *4 HSET doc:1 vec <16 raw bytes>
+	want := uint64(len("*4\r\n$4\r\nHSET\r\n$5\r\ndoc:1\r\n$3\r\nvec\r\n$16\r\n") + len(rawBinary) + 2)
 	if bytelen != want {
 		t.Fatalf("bytelen = %d, want %d (must reflect decoded 16B, not encoded 31B)", bytelen, want)
 	}
-	if bytelen >= uint64(len(row)) {
-		t.Fatalf("bytelen %d should be < raw row length %d when a __b64__ field is present", bytelen, len(row))
-	}
 }
 
 // A corrupt marked arg surfaces as a returned error (NOT os.Exit), so the
@@ -178,7 +169,7 @@ func TestPreProcessCmdDecodesMultipleMarkedArgs(t *testing.T) {
 }
 
 // Backward-compat regression guard: a plain row with NO marker parses exactly
-// as before — values untouched, key correct, bytelen = len(row)-len(cmdType).
+// as before — values untouched, key correct, bytelen the exact RESP size.
 func TestPreProcessCmdPlainRowUnchanged(t *testing.T) {
 	row := "SETUP,doc-1,1,HSET,doc:1,title,hello world"
 	cmdType, _, _, cmd, key, _, args, bytelen, err := preProcessCmd(row)
@@ -191,8 +182,8 @@ func TestPreProcessCmdPlainRowUnchanged(t *testing.T) {
 	if len(args) != 3 || args[0] != "doc:1" || args[1] != "title" || args[2] != "hello world" {
 		t.Fatalf("plain args altered: %q", args)
 	}
-	if want := uint64(len(row)) - uint64(len("SETUP")); bytelen != want {
-		t.Fatalf("bytelen = %d, want %d (no shrink expected without a marker)", bytelen, want)
+	if want := uint64(len("*4\r\n$4\r\nHSET\r\n$5\r\ndoc:1\r\n$5\r\ntitle\r\n$11\r\nhello world\r\n")); bytelen != want {
+		t.Fatalf("bytelen = %d, want %d", bytelen, want)
 	}
 }
 
@@ -248,3 +239,46 @@ func TestPreProcessCmdReadComputesClusterSlot(t *testing.T) {
 		t.Fatalf("clusterSlot = %d, want %d", clusterSlot, want)
 	}
 }
+
+// --do-benchmark=false parses every row exactly like a real run and accounts
+// the rows and their bytes (newline included) for the read-speed report.
+func TestParseRowsAccountsRowsAndBytes(t *testing.T) {
+	rows := []string{
+		"SETUP,doc-1,1,HSET,doc:1,title,hello world",
+		"SETUP,setup-doc-1,1,HSET,doc:1,vec," + binaryArgMarker + base64.StdEncoding.EncodeToString(rawBinary),
+	}
+	stat := benchmark_runner.NewStat()
+	parseRows(rows, stat)
+	if stat.InputRows() != 2 {
+		t.Fatalf("InputRows = %d, want 2", stat.InputRows())
+	}
+	if want := uint64(len(rows[0]) + len(rows[1]) + 2); stat.InputBytes() != want {
+		t.Fatalf("InputBytes = %d, want %d", stat.InputBytes(), want)
+	}
+	if stat.ParseTime() <= 0 {
+		t.Fatalf("ParseTime = %v, want > 0", stat.ParseTime())
+	}
+	if len(stat.CmdStats()) != 0 {
+		t.Fatalf("parsing must not record command stats, got %d", len(stat.CmdStats()))
+	}
+}
+
+// respRequestLen must match what radix actually writes for the command.
+func TestRespRequestLenMatchesRadixEncoding(t *testing.T) {
+	tests := [][]string{
+		{"PING"},
+		{"HSET", "doc:1", "title", "hello world", "n", "1234567890"},
+		{"FT.SEARCH", "idx", "*", "LIMIT", "0", "10"},
+		{"SET", "k", strings.Repeat("x", 12345)},
+		{"SET", "k", ""},
+	}
+	for _, cmd := range tests {
+		var buf bytes.Buffer
+		if err := radix.Cmd(nil, cmd[0], cmd[1:]...).MarshalRESP(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := respRequestLen(cmd[0], cmd[1:]); got != uint64(buf.Len()) {
+			t.Errorf("respRequestLen(%q) = %d, radix wrote %d bytes", cmd, got, buf.Len())
+		}
+	}
+}
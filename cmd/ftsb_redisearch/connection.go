@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	radix "github.com/mediocregopher/radix/v3"
+)
+
+// redisConn is one benchmark client connection: a single-connection pool, or in
+// cluster mode a cluster client holding one connection per node. Connections
+// are decoupled from workers: with --connections-per-worker (or --clients above
+// --workers) a worker drives several of them concurrently, and with --clients
+// below --workers several workers share one. Shared connections are reference
+// counted so the last worker to finish closes it.
+type redisConn struct {
+	id uint32
+
+	// mu guards pool, which reconnect may swap while other workers sharing the
+	// connection are sending on it.
+	mu      sync.RWMutex
+	pool    *radix.Pool
+	cluster *radix.Cluster
+	topo    radix.ClusterTopo
+
+	connect sync.Once
+	refs    int32
+}
+
+var (
+	connsMutex sync.Mutex
+	conns      = map[uint32]*redisConn{}
+)
+
+// totalConnections returns how many connections the run opens in total:
+// --clients when set, otherwise --connections-per-worker for every worker.
+func totalConnections(totalWorkers int) int {
+	if clients > 0 {
+		return clients
+	}
+	perWorker := connectionsPerWorker
+	if perWorker < 1 {
+		perWorker = 1
+	}
+	return totalWorkers * perWorker
+}
+
+// workerConnIds returns the ids of the connections worker workerNumber drives.
+// Connections are dealt round-robin across workers; when there are fewer
+// connections than workers, worker w shares connection w % connections.
+func workerConnIds(workerNumber, totalWorkers int) []uint32 {
+	total := totalConnections(totalWorkers)
+	if total < totalWorkers {
+		return []uint32{uint32(workerNumber % total)}
+	}
+	ids := make([]uint32, 0, total/totalWorkers+1)
+	for id := workerNumber; id < total; id += totalWorkers {
+		ids = append(ids, uint32(id))
+	}
+	return ids
+}
+
+// acquireConn returns the connection with the given id, dialing it on first
+// use, and takes a reference on it. Release it with release.
+func acquireConn(id uint32) *redisConn {
+	connsMutex.Lock()
+	c, exist := conns[id]
+	if !exist {
+		c = &redisConn{id: id}
+		conns[id] = c
+	}
+	atomic.AddInt32(&c.refs, 1)
+	connsMutex.Unlock()
+
+	c.connect.Do(c.dial)
+	return c
+}
+
+func (c *redisConn) dial() {
+	var err error = nil
+	if clusterMode {
+		customConnFunc := getCustomConnFunc()
+
+		// this cluster will use the ClientFunc to create a pool to each node in the
+		// cluster. OnEmptyWait keeps it at exactly one connection per node even
+		// when the cluster client is shared by several workers.
+		poolFunc := func(network, addr string) (radix.Client, error) {
+			return radix.NewPool(network, addr, int(1), radix.PoolConnFunc(customConnFunc), radix.PoolPipelineWindow(0, 0), radix.PoolOnEmptyWait())
+		}
+
+		// We dont want the cluster to sync during the benchmark so we increase the sync time to a large value ( and do the sync CLUSTER SLOTS ) prior
+		c.cluster, err = radix.NewCluster([]string{host}, radix.ClusterPoolFunc(poolFunc), radix.ClusterSyncEvery(1*time.Hour))
+		if err != nil {
+			log.Fatalf("Error preparing for redisearch ingestion, while creating new cluster connection. error = %v", err)
+		}
+		err = c.cluster.Sync()
+		if err != nil {
+			log.Fatalf("Error retrieving cluster topology. error = %v", err)
+		}
+		c.topo = c.cluster.Topo()
+	} else {
+		// We dont want PING to be issed from 5 to 5 seconds given that we know the connection is alive on the benchmark
+		c.pool, err = createPool()
+		if err != nil {
+			log.Fatalf("Error preparing for redisearch ingestion, while creating new pool. error = %v", err)
+		}
+	}
+}
+
+// dialSideClient opens a connection outside of the benchmark ones, for the
+// out-of-band --server-stats, --server-diagnostics and --profile-sample-rate
+// commands. In cluster mode
+// it is a cluster client with a connection per node.
+func dialSideClient() (radix.Client, error) {
+	if !clusterMode {
+		return radix.Dial("tcp", host, getDialOpts()...)
+	}
+	poolFunc := func(network, addr string) (radix.Client, error) {
+		return radix.NewPool(network, addr, 1, radix.PoolConnFunc(getCustomConnFunc()), radix.PoolPipelineWindow(0, 0))
+	}
+	return radix.NewCluster([]string{host}, radix.ClusterPoolFunc(poolFunc), radix.ClusterSyncEvery(1*time.Hour))
+}
+
+// sideClientNodes returns, by address, the clients to send per-server
+// commands such as INFO to: every primary of a cluster side client, or the
+// standalone client itself.
+func sideClientNodes(client radix.Client) (map[string]radix.Client, error) {
+	cluster, ok := client.(*radix.Cluster)
+	if !ok {
+		return map[string]radix.Client{host: client}, nil
+	}
+	nodes := map[string]radix.Client{}
+	for addr := range cluster.Topo().Primaries().Map() {
+		node, err := cluster.Client(addr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", addr, err)
+		}
+		nodes[addr] = node
+	}
+	return nodes, nil
+}
+
+// client returns the standalone client to send on.
+func (c *redisConn) client() radix.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pool
+}
+
+// reconnect closes the standalone pool and dials a new one, unless another
+// worker sharing the connection already replaced the failed client.
+func (c *redisConn) reconnect(failed radix.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pool != failed {
+		return
+	}
+	c.pool.Close()
+	pool, err := createPool()
+	if err != nil {
+		if continueOnErr {
+			// Keep the closed pool: its next Do fails fast and retries this.
+			log.Printf("Error reconnecting to Redis: %v", err)
+		} else {
+			log.Fatalf("Fatal error reconnecting to Redis: %v", err)
+		}
+		return
+	}
+	c.pool = pool
+	log.Println("Successfully reconnected to Redis after error")
+}
+
+// release drops a reference, closing the connection once no worker uses it.
+func (c *redisConn) release() {
+	if atomic.AddInt32(&c.refs, -1) > 0 {
+		return
+	}
+	connsMutex.Lock()
+	delete(conns, c.id)
+	connsMutex.Unlock()
+	if c.pool != nil {
+		c.pool.Close()
+	}
+	if c.cluster != nil {
+		c.cluster.Close()
+	}
+}
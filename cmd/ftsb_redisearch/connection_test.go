@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// workerConnIds must hand every connection to exactly one worker when there
+// are at least as many connections as workers, and share connections
+// round-robin when there are fewer.
+func TestWorkerConnIds(t *testing.T) {
+	savedPerWorker, savedClients := connectionsPerWorker, clients
+	defer func() { connectionsPerWorker, clients = savedPerWorker, savedClients }()
+
+	cases := []struct {
+		name               string
+		perWorker, clients int
+		workers            int
+		want               [][]uint32
+	}{
+		{"default one per worker", 1, 0, 3, [][]uint32{{0}, {1}, {2}}},
+		{"two per worker", 2, 0, 2, [][]uint32{{0, 2}, {1, 3}}},
+		{"clients above workers", 1, 5, 2, [][]uint32{{0, 2, 4}, {1, 3}}},
+		{"clients below workers", 4, 2, 5, [][]uint32{{0}, {1}, {0}, {1}, {0}}},
+	}
+	for _, c := range cases {
+		connectionsPerWorker, clients = c.perWorker, c.clients
+		for w := 0; w < c.workers; w++ {
+			if got := workerConnIds(w, c.workers); !reflect.DeepEqual(got, c.want[w]) {
+				t.Errorf("%s: workerConnIds(%d, %d) = %v, want %v", c.name, w, c.workers, got, c.want[w])
+			}
+		}
+	}
+}
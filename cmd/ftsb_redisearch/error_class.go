@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/RediSearch/ftsb/benchmark_runner"
+)
+
+// Error classes reported per command in Totals.ErrorsByClass and errorsTs.
+const (
+	errorClassOOM             = "OOM"
+	errorClassWrongType       = "WRONGTYPE"
+	errorClassBusy            = "BUSY"
+	errorClassLoading         = "LOADING"
+	errorClassRedirect        = "MOVED_ASK"
+	errorClassUnknownIndex    = "UNKNOWN_INDEX"
+	errorClassSyntax          = "SYNTAX"
+	errorClassTimeout         = "TIMEOUT"
+	errorClassConnectionReset = "CONNECTION_RESET"
+)
+
+// errorReplyPrefixes maps the first word of a Redis error reply to its class.
+var errorReplyPrefixes = map[string]string{
+	"OOM":       errorClassOOM,
+	"WRONGTYPE": errorClassWrongType,
+	"BUSY":      errorClassBusy,
+	"LOADING":   errorClassLoading,
+	"MOVED":     errorClassRedirect,
+	"ASK":       errorClassRedirect,
+}
+
+// classifyError returns the class of an error returned when sending commands:
+// either a Redis error reply, classified by its prefix or by the RediSearch
+// messages for missing indexes and query syntax errors, or a network error.
+// Anything else is benchmark_runner.UnclassifiedError.
+func classifyError(err error) string {
+	msg := err.Error()
+	prefix := msg
+	if i := strings.IndexByte(msg, ' '); i >= 0 {
+		prefix = msg[:i]
+	}
+	if class, ok := errorReplyPrefixes[prefix]; ok {
+		return class
+	}
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "unknown index") || strings.Contains(lower, "no such index"):
+		return errorClassUnknownIndex
+	case strings.Contains(lower, "syntax error"):
+		return errorClassSyntax
+	case strings.Contains(lower, "i/o timeout"):
+		return errorClassTimeout
+	case strings.Contains(lower, "connection reset") || strings.Contains(lower, "broken pipe"):
+		return errorClassConnectionReset
+	}
+	return benchmark_runner.UnclassifiedError
+}
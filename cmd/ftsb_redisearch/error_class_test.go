@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/RediSearch/ftsb/benchmark_runner"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  string
+		want string
+	}{
+		{"OOM command not allowed when used memory > 'maxmemory'.", errorClassOOM},
+		{"WRONGTYPE Operation against a key holding the wrong kind of value", errorClassWrongType},
+		{"BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSCRIPT.", errorClassBusy},
+		{"LOADING Redis is loading the dataset in memory", errorClassLoading},
+		{"MOVED 3999 127.0.0.1:6381", errorClassRedirect},
+		{"ASK 3999 127.0.0.1:6381", errorClassRedirect},
+		{"Unknown Index name", errorClassUnknownIndex},
+		{"idx: no such index", errorClassUnknownIndex},
+		{"Syntax error at offset 3 near hello", errorClassSyntax},
+		{"ERR syntax error", errorClassSyntax},
+		{"read tcp 127.0.0.1:50000->127.0.0.1:6379: i/o timeout", errorClassTimeout},
+		{"read tcp 127.0.0.1:50000->127.0.0.1:6379: read: connection reset by peer", errorClassConnectionReset},
+		{"write tcp 127.0.0.1:50000->127.0.0.1:6379: write: broken pipe", errorClassConnectionReset},
+		{"BUSYKEY Target key name already exists.", benchmark_runner.UnclassifiedError},
+		{"ERR unknown command 'FT.FOO'", benchmark_runner.UnclassifiedError},
+	}
+	for _, tt := range tests {
+		if got := classifyError(errors.New(tt.err)); got != tt.want {
+			t.Errorf("classifyError(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Deterministically guards the one-unit latency floor (independent of
+// wall-clock timing, unlike the fake-client pipeline test): a duration below
+// the latency unit must never record a physically-impossible 0 latency.
+func TestFlooredLatency(t *testing.T) {
+	cases := []struct {
+		d    time.Duration
+		unit time.Duration
+		want uint64
+	}{
+		{0, time.Microsecond, 1},                      // exactly zero -> floored
+		{500 * time.Nanosecond, time.Microsecond, 1},  // 0.5us truncates to 0 -> floored
+		{1500 * time.Nanosecond, time.Microsecond, 1}, // 1.5us truncates to 1
+		{2 * time.Microsecond, time.Microsecond, 2},
+		{1234 * time.Microsecond, time.Microsecond, 1234},
+		{0, time.Nanosecond, 1}, // exactly zero -> floored
+		{500 * time.Nanosecond, time.Nanosecond, 500},
+		{1234 * time.Microsecond, time.Nanosecond, 1234000},
+	}
+	for _, c := range cases {
+		if got := flooredLatency(c.d, c.unit); got != c.want {
+			t.Errorf("flooredLatency(%v, %v) = %d, want %d", c.d, c.unit, got, c.want)
+		}
+	}
+}
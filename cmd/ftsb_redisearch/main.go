@@ -14,18 +14,26 @@ import (
 
 // Program option vars:
 var (
-	host           string
-	password       string
-	debug          int
-	loader         *benchmark_runner.BenchmarkRunner
-	pipeline       int
-	clusterMode    bool
-	continueOnErr  bool
-	captureReplies bool
-	timeout        time.Duration
-	versionFlag    bool
-	logFile        string
-	timeoutSeconds int
+	host                 string
+	password             string
+	debug                int
+	loader               *benchmark_runner.BenchmarkRunner
+	pipeline             int
+	pipelineMaxLinger    time.Duration
+	connectionsPerWorker int
+	clients              int
+	clusterMode          bool
+	continueOnErr        bool
+	captureReplies       bool
+	timeout              time.Duration
+	versionFlag          bool
+	logFile              string
+	timeoutSeconds       int
+	serverStats          bool
+	serverStatsIndexes   string
+	serverDiagnostics    bool
+	profileSampleRate    float64
+	profiler             *queryProfiler
 )
 
 // Parse args:
@@ -35,10 +43,17 @@ func init() {
 	flag.StringVar(&password, "a", "", "Password for Redis Auth.")
 	flag.IntVar(&debug, "debug", 0, "Debug printing (choices: 0, 1, 2). (default 0)")
 	flag.BoolVar(&continueOnErr, "continue-on-error", true, "If set to true, it will continue the benchmark and print the error message to stderr.")
-	flag.BoolVar(&captureReplies, "capture-replies", false, "If true, decode each command's reply so RxBytes is populated. Off by default: capturing fully unmarshals every reply on the client hot path (allocation + reflection inside the measured latency window), which inflates FT.SEARCH/FT.AGGREGATE latency. Command errors are detected regardless of this setting.")
+	flag.BoolVar(&captureReplies, "capture-replies", false, "If true, decode each command's reply so RxBytes is populated and ReplyStats records the reply size and FT.SEARCH/FT.AGGREGATE total results distributions per query id. Off by default: capturing fully unmarshals every reply on the client hot path (allocation + reflection inside the measured latency window), which inflates FT.SEARCH/FT.AGGREGATE latency. Command errors are detected regardless of this setting.")
 	flag.BoolVar(&clusterMode, "cluster-mode", false, "If set to true, it will run the client in cluster mode.")
-	flag.IntVar(&pipeline, "pipeline", 1, "Pipeline <numreq> requests. Default 1 (no pipeline).")
+	flag.IntVar(&connectionsPerWorker, "connections-per-worker", 1, "Number of Redis connections each worker drives concurrently. Ignored when --clients is set.")
+	flag.IntVar(&clients, "clients", 0, "Total number of Redis connections, spread round-robin across workers. Below --workers, workers share connections. 0 = --workers * --connections-per-worker.")
+	flag.IntVar(&pipeline, "pipeline", 1, "Pipeline <numreq> requests. Default 1 (no pipeline). Every pipelined command records the whole round-trip as its latency; the json-out-file PipelineStats also reports the round-trips, the commands per round-trip and the amortized per-command latency.")
+	flag.DurationVar(&pipelineMaxLinger, "pipeline-max-linger", 0, "Maximum time a partially filled pipeline window waits for more commands before being sent (e.g. 200us). Combined with --pipeline, the window is flushed when either limit is reached. 0 = flush on command count only.")
 	flag.IntVar(&timeoutSeconds, "timeout", 60, "Redis connection timeout in seconds.")
+	flag.BoolVar(&serverStats, "server-stats", false, "Sample INFO memory, cpu, stats and commandstats (summed over the primaries in cluster mode), and FT.INFO of --server-stats-indexes, on a separate connection at the start and end of the run and every --reporting-period. Stored in the json-out-file TimeSeries serverTs and ServerStats, with the start/end deltas in the summary.")
+	flag.StringVar(&serverStatsIndexes, "server-stats-indexes", "", "Comma separated indexes whose FT.INFO is sampled with --server-stats.")
+	flag.BoolVar(&serverDiagnostics, "server-diagnostics", false, "Reset SLOWLOG and LATENCY (when permitted) before the run, and capture SLOWLOG GET, LATENCY LATEST and LATENCY HISTOGRAM of every server after it into the json-out-file ServerDiagnostics.")
+	flag.Float64Var(&profileSampleRate, "profile-sample-rate", 0, "Fraction (0-1) of the FT.SEARCH and FT.AGGREGATE commands to run as FT.PROFILE instead, one at a time on a separate connection. The per-iterator and per-result-processor timings are aggregated per query id in the json-out-file QueryProfiles. The profiled commands are not part of the latency histograms and totals. 0 = disabled.")
 	flag.BoolVar(&versionFlag, "version", false, "Print the version and exit.")
 	flag.StringVar(&logFile, "log-file", "", "File to write all log output (in addition to stdout/stderr). If not set, logs only to stdout/stderr.")
 }
@@ -51,6 +66,14 @@ func parseFlags() {
 	// Convert seconds to time.Duration
 	timeout = time.Duration(timeoutSeconds) * time.Second
 
+	if profileSampleRate < 0 || profileSampleRate > 1 {
+		log.Fatalf("--profile-sample-rate must be between 0 and 1 (got %v)", profileSampleRate)
+	}
+
+	if connectionsPerWorker < 1 || clients < 0 {
+		log.Fatalf("--connections-per-worker must be >= 1 and --clients >= 0 (got %d and %d)", connectionsPerWorker, clients)
+	}
+
 	// Handle version flag
 	if versionFlag {
 		fmt.Printf("Version: %s (Dirty: %s)\n", GitSHA1, GitDirty)
@@ -69,7 +92,14 @@ func (b *benchmark) GetConfigurationParametersMap() map[string]interface{} {
 	configs["captureReplies"] = captureReplies
 	configs["debug"] = debug
 	configs["pipeline"] = pipeline
+	configs["pipelineMaxLinger"] = pipelineMaxLinger.String()
+	configs["connectionsPerWorker"] = connectionsPerWorker
+	configs["clients"] = clients
 	configs["logFile"] = logFile
+	configs["serverStats"] = serverStats
+	configs["serverStatsIndexes"] = serverStatsIndexes
+	configs["serverDiagnostics"] = serverDiagnostics
+	configs["profileSampleRate"] = profileSampleRate
 	return configs
 }
 
@@ -100,7 +130,26 @@ func (b *benchmark) GetProcessor() benchmark_runner.Processor {
 	return &processor{}
 }
 
+func (b *benchmark) StopProfiling() {
+	if profiler != nil {
+		profiler.StopProfiling()
+	}
+}
+
+func (b *benchmark) GetQueryProfilesMap() map[string]interface{} {
+	if profiler == nil {
+		return nil
+	}
+	return profiler.GetQueryProfilesMap()
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		if err := runReport(os.Args[2:]); err != nil {
+			log.Fatalf("report: %v", err)
+		}
+		return
+	}
 	parseFlags()
 	b := benchmark{}
 	git_sha := toolGitSHA1()
@@ -127,5 +176,6 @@ func main() {
 	}
 
 	log.Printf("ftsb (git_sha1:%s%s)\n", git_sha, git_dirty_str)
+	profiler = newQueryProfiler(profileSampleRate)
 	loader.RunBenchmark(&b, benchmark_runner.SingleQueue)
 }
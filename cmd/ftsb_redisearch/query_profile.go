@@ -0,0 +1,447 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	radix "github.com/mediocregopher/radix/v3"
+)
+
+// profileQueueSize bounds the commands waiting to be profiled. Commands
+// sampled while it is full are sent as usual instead, so the workers never
+// wait on the profiler.
+const profileQueueSize = 64
+
+// Top level FT.PROFILE entries holding the per-stage breakdowns; every other
+// entry with a numeric value is a timing such as "Total profile time".
+const (
+	profileIterators        = "Iterators profile"
+	profileResultProcessors = "Result processors profile"
+	profileChildIterators   = "Child iterators"
+)
+
+// profileRequest is a sampled FT.SEARCH or FT.AGGREGATE row.
+type profileRequest struct {
+	groupAndQuery string
+	cmd           string
+	args          []string
+}
+
+// queryProfiler runs a --profile-sample-rate fraction of the FT.SEARCH and
+// FT.AGGREGATE commands as FT.PROFILE instead, one at a time on a connection of
+// its own, and aggregates the profiles per "LABEL-queryId". The sampled
+// commands are not sent by the workers, so they add no load and are left out
+// of the latency histograms and totals.
+type queryProfiler struct {
+	rate   float64
+	client radix.Client
+	queue  chan profileRequest
+	done   chan struct{}
+
+	dropped uint64
+
+	// mu guards profiles, which the profiler goroutine updates while
+	// GetQueryProfilesMap may be called
+	mu       sync.Mutex
+	profiles map[string]*queryProfile
+}
+
+// queryProfile aggregates the FT.PROFILE replies of one "LABEL-queryId":
+// the top level timings, and the time and counter of each iterator (keyed by
+// its path of iterator types, e.g. INTERSECT/UNION/TEXT) and of each result
+// processor (keyed by type). Timings are in milliseconds, as reported.
+type queryProfile struct {
+	samples    int64
+	errors     int64
+	timings    map[string]*profileStat
+	iterators  map[string]map[string]*profileStat
+	processors map[string]map[string]*profileStat
+}
+
+// profileStat is the mean and max of one profiled value.
+type profileStat struct {
+	sum, max float64
+	n        int64
+}
+
+func (s *profileStat) add(v float64) {
+	if s.n == 0 || v > s.max {
+		s.max = v
+	}
+	s.sum += v
+	s.n++
+}
+
+func (s *profileStat) toMap() map[string]float64 {
+	return map[string]float64{"mean": s.sum / float64(s.n), "max": s.max}
+}
+
+// profileSample is the parsed profile of one FT.PROFILE reply. In cluster
+// mode the shards' values are summed.
+type profileSample struct {
+	timings    map[string]float64
+	iterators  map[string]map[string]float64
+	processors map[string]map[string]float64
+}
+
+func newProfileSample() *profileSample {
+	return &profileSample{
+		timings:    map[string]float64{},
+		iterators:  map[string]map[string]float64{},
+		processors: map[string]map[string]float64{},
+	}
+}
+
+// newQueryProfiler returns the --profile-sample-rate profiler, or nil when
+// disabled or when its connection cannot be opened.
+func newQueryProfiler(rate float64) *queryProfiler {
+	if rate <= 0 {
+		return nil
+	}
+	client, err := dialSideClient()
+	if err != nil {
+		log.Printf("Warning! Disabling query profiling, cannot connect: %v", err)
+		return nil
+	}
+	q := &queryProfiler{
+		rate:     rate,
+		client:   client,
+		queue:    make(chan profileRequest, profileQueueSize),
+		done:     make(chan struct{}),
+		profiles: map[string]*queryProfile{},
+	}
+	go q.run()
+	return q
+}
+
+// sample queues a sampled FT.SEARCH or FT.AGGREGATE command for profiling,
+// and returns whether it did, in which case the caller must not send it.
+// Safe to call from every worker.
+func (q *queryProfiler) sample(cmdType, cmdQueryId, cmd string, args []string) bool {
+	upper := strings.ToUpper(cmd)
+	if (upper != "FT.SEARCH" && upper != "FT.AGGREGATE") || len(args) < 2 {
+		return false
+	}
+	// NOSONAR: math/rand is fine for picking which commands to profile
+	if rand.Float64() >= q.rate { // NOSONAR
+		return false
+	}
+	select {
+	case q.queue <- profileRequest{groupAndQuery: cmdType + "-" + cmdQueryId, cmd: upper, args: args}:
+		return true
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+		return false
+	}
+}
+
+func (q *queryProfiler) run() {
+	defer close(q.done)
+	failures := 0
+	for req := range q.queue {
+		// FT.PROFILE <index> SEARCH|AGGREGATE QUERY <query> [options...]
+		profileArgs := make([]string, 0, len(req.args)+2)
+		profileArgs = append(profileArgs, req.args[0], strings.TrimPrefix(req.cmd, "FT."), "QUERY")
+		profileArgs = append(profileArgs, req.args[1:]...)
+		var reply []interface{}
+		err := q.client.Do(radix.Cmd(&reply, "FT.PROFILE", profileArgs...))
+		var sample *profileSample
+		if err == nil {
+			sample = parseProfileReply(reply)
+		} else if failures == 0 {
+			log.Printf("Warning! FT.PROFILE of %s failed: %v", req.groupAndQuery, err)
+		}
+		if sample == nil {
+			failures++
+		}
+		q.record(req.groupAndQuery, sample)
+	}
+}
+
+// record adds a parsed profile to the aggregate of groupAndQuery, or counts an
+// error when sample is nil.
+func (q *queryProfiler) record(groupAndQuery string, sample *profileSample) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p, exist := q.profiles[groupAndQuery]
+	if !exist {
+		p = &queryProfile{
+			timings:    map[string]*profileStat{},
+			iterators:  map[string]map[string]*profileStat{},
+			processors: map[string]map[string]*profileStat{},
+		}
+		q.profiles[groupAndQuery] = p
+	}
+	if sample == nil {
+		p.errors++
+		return
+	}
+	p.samples++
+	for k, v := range sample.timings {
+		if p.timings[k] == nil {
+			p.timings[k] = &profileStat{}
+		}
+		p.timings[k].add(v)
+	}
+	addProfileStages(p.iterators, sample.iterators)
+	addProfileStages(p.processors, sample.processors)
+}
+
+func addProfileStages(stats map[string]map[string]*profileStat, sample map[string]map[string]float64) {
+	for stage, values := range sample {
+		if stats[stage] == nil {
+			stats[stage] = map[string]*profileStat{}
+		}
+		for k, v := range values {
+			if stats[stage][k] == nil {
+				stats[stage][k] = &profileStat{}
+			}
+			stats[stage][k].add(v)
+		}
+	}
+}
+
+// StopProfiling profiles the commands still queued and closes the connection.
+func (q *queryProfiler) StopProfiling() {
+	close(q.queue)
+	<-q.done
+	q.client.Close()
+	if dropped := atomic.LoadUint64(&q.dropped); dropped > 0 {
+		log.Printf("Warning! %d sampled commands were sent without profiling: FT.PROFILE could not keep up with --profile-sample-rate", dropped)
+	}
+}
+
+// GetQueryProfilesMap returns the aggregated FT.PROFILE breakdowns per
+// "LABEL-queryId", with the mean and max of each value.
+func (q *queryProfiler) GetQueryProfilesMap() map[string]interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.profiles) == 0 {
+		return nil
+	}
+	configs := map[string]interface{}{}
+	for k, p := range q.profiles {
+		mp := map[string]interface{}{}
+		mp["Samples"] = p.samples
+		mp["Errors"] = p.errors
+		timings := map[string]interface{}{}
+		for name, stat := range p.timings {
+			timings[name] = stat.toMap()
+		}
+		mp["Timings"] = timings
+		mp["Iterators"] = profileStagesMap(p.iterators)
+		mp["ResultProcessors"] = profileStagesMap(p.processors)
+		configs[k] = mp
+	}
+	return configs
+}
+
+func profileStagesMap(stats map[string]map[string]*profileStat) map[string]interface{} {
+	stages := map[string]interface{}{}
+	for stage, values := range stats {
+		mp := map[string]interface{}{}
+		for k, stat := range values {
+			mp[k] = stat.toMap()
+		}
+		stages[stage] = mp
+	}
+	return stages
+}
+
+// parseProfileReply parses the profile half of a [results, profile] FT.PROFILE
+// reply, or returns nil when it holds no profile. Both the RediSearch 2.x
+// layout, a list of [name, value...] entries, and the later one, a flat
+// name/value list possibly nested per shard, are supported.
+func parseProfileReply(reply []interface{}) *profileSample {
+	if len(reply) < 2 {
+		return nil
+	}
+	sample := newProfileSample()
+	found := false
+	walkProfile(reply[1], sample, &found)
+	if !found {
+		return nil
+	}
+	return sample
+}
+
+// walkProfile looks for profile entries in v, descending into the lists that
+// are not entries themselves (e.g. per shard profiles).
+func walkProfile(v interface{}, sample *profileSample, found *bool) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return
+	}
+	for _, e := range profileEntries(list) {
+		switch e.name {
+		case profileIterators:
+			*found = true
+			for _, value := range e.values {
+				for _, node := range profileNodes(value) {
+					addIterator(node, "", sample)
+				}
+			}
+		case profileResultProcessors:
+			*found = true
+			for _, value := range e.values {
+				for _, node := range profileNodes(value) {
+					addStage(sample.processors, node, profileNodeType(node))
+				}
+			}
+		default:
+			if len(e.values) != 1 {
+				continue
+			}
+			if f, ok := profileNumber(e.values[0]); ok {
+				*found = true
+				sample.timings[e.name] += f
+			} else {
+				walkProfile(e.values[0], sample, found)
+			}
+		}
+	}
+}
+
+type profileEntry struct {
+	name   string
+	values []interface{}
+}
+
+// profileEntries reads list as a flat name, value... list when it starts with
+// a name, as RediSearch 2.x [name, value...] entries when its elements look
+// like ones, and as a list of nested profiles (e.g. one per shard) otherwise.
+func profileEntries(list []interface{}) []profileEntry {
+	var entries []profileEntry
+	if len(list) == 0 {
+		return nil
+	}
+	if _, ok := respString(list[0]); ok {
+		for i := 0; i+1 < len(list); i += 2 {
+			if name, ok := respString(list[i]); ok {
+				entries = append(entries, profileEntry{name: name, values: list[i+1 : i+2]})
+			}
+		}
+		return entries
+	}
+	for _, v := range list {
+		l, ok := v.([]interface{})
+		if !ok || !isProfileEntry(l) {
+			// nested profiles: descend into each of them
+			entries = entries[:0]
+			for _, v := range list {
+				entries = append(entries, profileEntry{values: []interface{}{v}})
+			}
+			return entries
+		}
+		name, _ := respString(l[0])
+		entries = append(entries, profileEntry{name: name, values: l[1:]})
+	}
+	return entries
+}
+
+// isProfileEntry tells a RediSearch 2.x [name, value...] entry, whose values
+// after the first are lists (result processors), from a flat name/value
+// profile, which has a name every other element.
+func isProfileEntry(l []interface{}) bool {
+	if len(l) < 2 {
+		return false
+	}
+	if _, ok := respString(l[0]); !ok {
+		return false
+	}
+	if len(l) == 2 {
+		return true
+	}
+	_, isName := respString(l[2])
+	return !isName
+}
+
+// profileNodes returns v as a list of iterator or result processor nodes:
+// v itself when it is a node, its elements when it is a list of nodes.
+func profileNodes(v interface{}) [][]interface{} {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil
+	}
+	if _, ok := respString(list[0]); ok {
+		return [][]interface{}{list}
+	}
+	var nodes [][]interface{}
+	for _, e := range list {
+		if node, ok := e.([]interface{}); ok {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// profileNodeType returns the Type of an iterator or result processor node.
+func profileNodeType(node []interface{}) string {
+	for i := 0; i+1 < len(node); i++ {
+		if name, ok := respString(node[i]); ok && name == "Type" {
+			if t, ok := respString(node[i+1]); ok {
+				return t
+			}
+		}
+	}
+	return "UNKNOWN"
+}
+
+// addIterator adds the Time and Counter of an iterator node under its type
+// path, then descends into its child iterators. Children follow the
+// "Child iterators" name either as one list of nodes or, in RediSearch 2.x,
+// as one node each.
+func addIterator(node []interface{}, parent string, sample *profileSample) {
+	path := profileNodeType(node)
+	if parent != "" {
+		path = parent + "/" + path
+	}
+	addStage(sample.iterators, node, path)
+	for i := 0; i < len(node); i++ {
+		if name, ok := respString(node[i]); !ok || name != profileChildIterators {
+			continue
+		}
+		for _, child := range node[i+1:] {
+			if _, ok := respString(child); ok {
+				break
+			}
+			for _, childNode := range profileNodes(child) {
+				addIterator(childNode, path, sample)
+			}
+		}
+	}
+}
+
+// addStage adds the numeric Time and Counter values of a node to stage.
+func addStage(stages map[string]map[string]float64, node []interface{}, stage string) {
+	if stages[stage] == nil {
+		stages[stage] = map[string]float64{}
+	}
+	for i := 0; i+1 < len(node); i++ {
+		name, ok := respString(node[i])
+		if !ok || (name != "Time" && name != "Counter") {
+			continue
+		}
+		if f, ok := profileNumber(node[i+1]); ok {
+			stages[stage][name] += f
+		}
+	}
+}
+
+// profileNumber returns an integer reply, or a string one holding a number,
+// as a float64.
+func profileNumber(v interface{}) (float64, bool) {
+	if i, ok := v.(int64); ok {
+		return float64(i), true
+	}
+	str, ok := respString(v)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	return f, err == nil
+}
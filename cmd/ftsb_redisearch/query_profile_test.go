@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+)
+
+func iteratorNode(typ string, time string, counter int64, children ...interface{}) []interface{} {
+	node := []interface{}{"Type", typ, "Time", time, "Counter", counter}
+	if len(children) > 0 {
+		node = append(node, "Child iterators")
+		node = append(node, children...)
+	}
+	return node
+}
+
+func rpNode(typ string, time string, counter int64) []interface{} {
+	return []interface{}{"Type", typ, "Time", time, "Counter", counter}
+}
+
+func checkProfileSample(t *testing.T, sample *profileSample, textTime, textCounter float64) {
+	t.Helper()
+	if sample == nil {
+		t.Fatal("parseProfileReply = nil")
+	}
+	if sample.timings["Total profile time"] != 0.5 || sample.timings["Parsing time"] != 0.01 {
+		t.Errorf("timings = %v", sample.timings)
+	}
+	if got := sample.iterators["UNION"]; got["Time"] != 0.3 || got["Counter"] != 7 {
+		t.Errorf("UNION iterator = %v", got)
+	}
+	if got := sample.iterators["UNION/TEXT"]; got["Time"] != textTime || got["Counter"] != textCounter {
+		t.Errorf("UNION/TEXT iterator = %v, want Time %v Counter %v", got, textTime, textCounter)
+	}
+	if got := sample.processors["Sorter"]; got["Time"] != 0.04 || got["Counter"] != 1 {
+		t.Errorf("Sorter result processor = %v", got)
+	}
+	if len(sample.processors) != 2 {
+		t.Errorf("result processors = %v, want Index and Sorter", sample.processors)
+	}
+}
+
+func TestParseProfileReplyEntries(t *testing.T) {
+	// RediSearch 2.x: [name, value...] entries, children inline after
+	// "Child iterators"
+	profile := []interface{}{
+		[]interface{}{"Total profile time", "0.5"},
+		[]interface{}{[]byte("Parsing time"), []byte("0.01")},
+		[]interface{}{"Iterators profile", iteratorNode("UNION", "0.3", 7,
+			iteratorNode("TEXT", "0.1", 3), iteratorNode("TEXT", "0.15", 4))},
+		[]interface{}{"Result processors profile", rpNode("Index", "0.05", 7), rpNode("Sorter", "0.04", 1)},
+	}
+	sample := parseProfileReply([]interface{}{[]interface{}{int64(1)}, profile})
+	// sibling iterators of the same type add up
+	checkProfileSample(t, sample, 0.25, 7)
+}
+
+func TestParseProfileReplyShards(t *testing.T) {
+	// later versions: flat name/value lists, one profile per shard, children
+	// as one list
+	shard := []interface{}{
+		"Total profile time", "0.25",
+		"Parsing time", "0.005",
+		"Iterators profile", []interface{}{iteratorNode("UNION", "0.15", 3,
+			[]interface{}{iteratorNode("TEXT", "0.1", 2)})},
+		"Result processors profile", []interface{}{rpNode("Index", "0.025", 3), rpNode("Sorter", "0.02", int64(0))},
+	}
+	shard2 := append([]interface{}{}, shard...)
+	shard2[7] = []interface{}{rpNode("Index", "0.025", 4), rpNode("Sorter", "0.02", 1)}
+	shard2[5] = []interface{}{iteratorNode("UNION", "0.15", 4, []interface{}{iteratorNode("TEXT", "0.1", 2)})}
+	profile := []interface{}{"Shards", []interface{}{shard, shard2}, "Coordinator", []interface{}{"Total Coordinator time", "0.1"}}
+	sample := parseProfileReply([]interface{}{[]interface{}{int64(1)}, profile})
+	// the shards add up
+	checkProfileSample(t, sample, 0.2, 4)
+	if sample.timings["Total Coordinator time"] != 0.1 {
+		t.Errorf("coordinator timing = %v", sample.timings)
+	}
+}
+
+func TestParseProfileReplyWithoutProfile(t *testing.T) {
+	if sample := parseProfileReply([]interface{}{[]interface{}{int64(0)}}); sample != nil {
+		t.Errorf("parseProfileReply without profile = %v", sample)
+	}
+	if sample := parseProfileReply([]interface{}{[]interface{}{int64(0)}, "OK"}); sample != nil {
+		t.Errorf("parseProfileReply with a non-profile = %v", sample)
+	}
+}
+
+func TestQueryProfilerAggregates(t *testing.T) {
+	q := &queryProfiler{rate: 1, queue: make(chan profileRequest, 1), profiles: map[string]*queryProfile{}}
+	// only the queued command is taken from the workers
+	if q.sample("WRITE", "W1", "HSET", []string{"k", "f", "v"}) {
+		t.Errorf("HSET should not be profiled")
+	}
+	if !q.sample("READ", "R1", "ft.search", []string{"idx", "@f:v"}) {
+		t.Errorf("FT.SEARCH should be profiled")
+	}
+	if q.sample("READ", "R1", "FT.AGGREGATE", []string{"idx", "*"}) {
+		t.Errorf("FT.AGGREGATE should be sent as usual when the queue is full")
+	}
+	if len(q.queue) != 1 || q.dropped != 1 {
+		t.Fatalf("queued %d, dropped %d: want 1 FT.SEARCH queued and 1 dropped", len(q.queue), q.dropped)
+	}
+	req := <-q.queue
+	if req.groupAndQuery != "READ-R1" || req.cmd != "FT.SEARCH" {
+		t.Errorf("queued %+v", req)
+	}
+
+	first := newProfileSample()
+	first.timings["Total profile time"] = 1
+	first.iterators["TEXT"] = map[string]float64{"Time": 0.5, "Counter": 2}
+	second := newProfileSample()
+	second.timings["Total profile time"] = 3
+	second.iterators["TEXT"] = map[string]float64{"Time": 1.5, "Counter": 4}
+	q.record("READ-R1", first)
+	q.record("READ-R1", second)
+	q.record("READ-R1", nil)
+
+	profiles := q.GetQueryProfilesMap()
+	r1 := profiles["READ-R1"].(map[string]interface{})
+	if r1["Samples"] != int64(2) || r1["Errors"] != int64(1) {
+		t.Errorf("Samples %v Errors %v, want 2 and 1", r1["Samples"], r1["Errors"])
+	}
+	total := r1["Timings"].(map[string]interface{})["Total profile time"].(map[string]float64)
+	if total["mean"] != 2 || total["max"] != 3 {
+		t.Errorf("Total profile time = %v, want mean 2 max 3", total)
+	}
+	text := r1["Iterators"].(map[string]interface{})["TEXT"].(map[string]interface{})
+	if got := text["Counter"].(map[string]float64); got["mean"] != 3 || got["max"] != 4 {
+		t.Errorf("TEXT Counter = %v, want mean 3 max 4", got)
+	}
+}
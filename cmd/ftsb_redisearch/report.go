@@ -0,0 +1,584 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+
+	"github.com/RediSearch/ftsb/benchmark_runner"
+)
+
+// labelKeys are the per-label OverallQuantiles and TimeSeries keys, in report
+// order.
+var labelKeys = []string{"allCommands", "setupWrite", "write", "update", "read", "readCursor", "delete"}
+
+// distributionPercentiles are the percentiles of the distributions
+// reconstructed from the per-second histograms.
+var distributionPercentiles = []float64{0, 50, 75, 90, 95, 99, 99.9, 99.99, 99.999, 100}
+
+// reportResult is the part of a --json-out-file result the report renders.
+type reportResult struct {
+	Name string `json:"-"`
+
+	Metadata            string                                  `json:"Metadata"`
+	ResultFormatVersion string                                  `json:"ResultFormatVersion"`
+	Limit               uint64                                  `json:"Limit"`
+	Workers             uint                                    `json:"Workers"`
+	InputReaders        uint                                    `json:"InputReaders"`
+	MaxRps              uint64                                  `json:"MaxRps"`
+	LatencyUnit         string                                  `json:"LatencyUnit"`
+	Percentiles         map[string]float64                      `json:"Percentiles"`
+	DBSpecificConfigs   map[string]interface{}                  `json:"DBSpecificConfigs"`
+	StartTime           int64                                   `json:"StartTime"`
+	EndTime             int64                                   `json:"EndTime"`
+	DurationMillis      int64                                   `json:"DurationMillis"`
+	Totals              map[string]interface{}                  `json:"Totals"`
+	OverallRates        map[string]interface{}                  `json:"OverallRates"`
+	OverallQuantiles    map[string]map[string]float64           `json:"OverallQuantiles"`
+	TimeSeries          map[string][]benchmark_runner.DataPoint `json:"TimeSeries"`
+
+	PerSecondEncodedHistograms      map[uint64]string            `json:"PerSecondEncodedHistograms"`
+	PerSecondEncodedLabelHistograms map[string]map[uint64]string `json:"PerSecondEncodedLabelHistograms"`
+}
+
+// reportSection is the rendered content of one result, shared by the HTML and
+// Markdown reports.
+type reportSection struct {
+	Name              string
+	Config            [][2]string
+	Totals            [][2]string
+	QuantileKeys      []string
+	Quantiles         []quantileRow
+	Throughput        lineChart
+	Latency           []lineChart
+	Distribution      distribution
+	DistributionChart lineChart
+}
+
+type quantileRow struct {
+	Key    string
+	Values []float64
+}
+
+// distribution holds the latency (ms) at each distributionPercentiles of each
+// series, e.g. allCommands and the labels.
+type distribution struct {
+	Series []string
+	Values [][]float64
+}
+
+// runReport implements `ftsb_redisearch report [flags] result.json...`.
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	htmlOut := fs.String("html-out", "report.html", "File to write the HTML report to. Empty to skip it.")
+	markdownOut := fs.String("markdown-out", "report.md", "File to write the Markdown report to. Empty to skip it.")
+	title := fs.String("title", "ftsb report", "Title of the report.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s report [flags] result.json...\n\nRenders --json-out-file results as a self-contained HTML and a Markdown report.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no result files given")
+	}
+	results := make([]*reportResult, 0, fs.NArg())
+	for _, fileName := range fs.Args() {
+		result, err := loadReportResult(fileName)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+	sections := make([]reportSection, 0, len(results))
+	for _, result := range results {
+		section, err := newReportSection(result)
+		if err != nil {
+			return fmt.Errorf("%s: %v", result.Name, err)
+		}
+		sections = append(sections, section)
+	}
+	comparison := newComparison(results, sections)
+	if *htmlOut != "" {
+		html, err := renderHTMLReport(*title, comparison, sections)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*htmlOut, []byte(html), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", *htmlOut)
+	}
+	if *markdownOut != "" {
+		if err := os.WriteFile(*markdownOut, []byte(renderMarkdownReport(*title, comparison, sections)), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", *markdownOut)
+	}
+	return nil
+}
+
+func loadReportResult(fileName string) (*reportResult, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	result := &reportResult{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", fileName, err)
+	}
+	result.Name = filepath.Base(fileName)
+	return result, nil
+}
+
+// unitsPerMilli is how many units of the result's latency histograms make a
+// millisecond; results predating LatencyUnit are in microseconds.
+func (r *reportResult) unitsPerMilli() float64 {
+	if r.LatencyUnit == "ns" {
+		return 1e6
+	}
+	return 1e3
+}
+
+func newReportSection(r *reportResult) (reportSection, error) {
+	s := reportSection{Name: r.Name}
+	s.Config = [][2]string{
+		{"Metadata", r.Metadata},
+		{"ResultFormatVersion", r.ResultFormatVersion},
+		{"Workers", strconv.FormatUint(uint64(r.Workers), 10)},
+		{"InputReaders", strconv.FormatUint(uint64(r.InputReaders), 10)},
+		{"Limit", strconv.FormatUint(r.Limit, 10)},
+		{"MaxRps", strconv.FormatUint(r.MaxRps, 10)},
+		{"LatencyUnit", r.LatencyUnit},
+	}
+	s.Config = append(s.Config, flatten("", r.DBSpecificConfigs)...)
+	s.Totals = [][2]string{{"DurationMillis", strconv.FormatInt(r.DurationMillis, 10)}}
+	s.Totals = append(s.Totals, flatten("", r.Totals)...)
+	s.Totals = append(s.Totals, flatten("", r.OverallRates)...)
+	s.QuantileKeys, s.Quantiles = r.quantileTable()
+	s.Throughput = r.throughputChart()
+	s.Latency = r.latencyCharts(s.QuantileKeys)
+	dist, err := r.distribution()
+	if err != nil {
+		return s, err
+	}
+	s.Distribution = dist
+	s.DistributionChart = distributionChart("Latency percentile distribution", dist.Series, dist.Values)
+	return s, nil
+}
+
+// flatten returns the name,value pairs of m in name order, nested maps
+// flattened to <key>.<nested key>.
+func flatten(prefix string, m map[string]interface{}) [][2]string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs [][2]string
+	for _, k := range keys {
+		switch v := m[k].(type) {
+		case map[string]interface{}:
+			pairs = append(pairs, flatten(prefix+k+".", v)...)
+		case float64:
+			pairs = append(pairs, [2]string{prefix + k, strconv.FormatFloat(v, 'f', -1, 64)})
+		default:
+			pairs = append(pairs, [2]string{prefix + k, fmt.Sprint(v)})
+		}
+	}
+	return pairs
+}
+
+// defaultQuantileKeys are the percentiles of the default --percentiles keys,
+// for results written before the key to percentile pairs were recorded.
+var defaultQuantileKeys = map[string]float64{"q0": 0, "q50": 50, "q95": 95, "q99": 99, "q999": 99.9, "q100": 100}
+
+// quantilePercentile returns the percentile of an OverallQuantiles key, as
+// recorded in the result's Percentiles or, failing that, of a default key.
+// Keys are not parsed back: q25 may be 25 or 2.5.
+func (r *reportResult) quantilePercentile(key string) (float64, bool) {
+	if r.Percentiles != nil {
+		p, ok := r.Percentiles[key]
+		return p, ok
+	}
+	p, ok := defaultQuantileKeys[key]
+	return p, ok
+}
+
+// quantileTable returns the quantile keys by percentile, those of unknown
+// percentile last in name order, and a row per recorded OverallQuantiles key:
+// the labels first, then the query ids, in name order.
+func (r *reportResult) quantileTable() ([]string, []quantileRow) {
+	overall := r.OverallQuantiles
+	seen := map[string]bool{}
+	var keys []string
+	for _, values := range overall {
+		for k := range values {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, oki := r.quantilePercentile(keys[i])
+		pj, okj := r.quantilePercentile(keys[j])
+		if oki != okj {
+			return oki
+		}
+		if oki && pi != pj {
+			return pi < pj
+		}
+		return keys[i] < keys[j]
+	})
+	names := make([]string, 0, len(overall))
+	for k := range overall {
+		names = append(names, k)
+	}
+	rank := func(name string) int {
+		for i, label := range labelKeys {
+			if strings.TrimSuffix(name, "Errors") == label {
+				return i
+			}
+		}
+		return len(labelKeys)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if ri, rj := rank(names[i]), rank(names[j]); ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+	rows := make([]quantileRow, 0, len(names))
+	for _, name := range names {
+		row := quantileRow{Key: name}
+		recorded := false
+		for _, k := range keys {
+			row.Values = append(row.Values, overall[name][k])
+			recorded = recorded || overall[name][k] > 0
+		}
+		// labels without commands are all zeros
+		if recorded {
+			rows = append(rows, row)
+		}
+	}
+	return keys, rows
+}
+
+// activeLabels returns the labels whose timeseries had commands.
+func (r *reportResult) activeLabels() []string {
+	var labels []string
+	for _, label := range labelKeys {
+		for _, dp := range r.TimeSeries[label+"Ts"] {
+			if dp.MultiValues["rate"] > 0 {
+				labels = append(labels, label)
+				break
+			}
+		}
+	}
+	return labels
+}
+
+// seriesPoints returns the value of each datapoint of the series against the
+// seconds since the start of the run.
+func (r *reportResult) seriesPoints(series, value string) []chartPoint {
+	datapoints := r.TimeSeries[series]
+	points := make([]chartPoint, 0, len(datapoints))
+	for _, dp := range datapoints {
+		points = append(points, chartPoint{X: float64(dp.Timestamp) - float64(r.StartTime)/1000, Y: dp.MultiValues[value]})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].X < points[j].X })
+	return points
+}
+
+func (r *reportResult) throughputChart() lineChart {
+	chart := lineChart{Title: "Throughput", XLabel: "seconds", YLabel: "ops/sec"}
+	for _, label := range r.activeLabels() {
+		chart.Series = append(chart.Series, chartSeries{Name: label, Points: r.seriesPoints(label+"Ts", "rate")})
+	}
+	return chart
+}
+
+// tailQuantileKey returns the key of q99, or else of the highest reported
+// percentile below it, or else of the lowest one above it (below 100), above
+// the median. Empty when there is none.
+func (r *reportResult) tailQuantileKey(quantileKeys []string) string {
+	tail := ""
+	for _, k := range quantileKeys {
+		if p, ok := r.quantilePercentile(k); ok && p > 50 && p < 100 && (tail == "" || p <= 99) {
+			tail = k
+		}
+	}
+	return tail
+}
+
+// latencyCharts returns a latency-over-time chart per label for the median
+// and for the tailQuantileKey.
+func (r *reportResult) latencyCharts(quantileKeys []string) []lineChart {
+	var charts []lineChart
+	for _, k := range []string{"q50", r.tailQuantileKey(quantileKeys)} {
+		if k == "" {
+			continue
+		}
+		chart := lineChart{Title: k + " latency", XLabel: "seconds", YLabel: "ms"}
+		for _, label := range r.activeLabels() {
+			chart.Series = append(chart.Series, chartSeries{Name: label, Points: r.seriesPoints(label+"Ts", k)})
+		}
+		charts = append(charts, chart)
+	}
+	return charts
+}
+
+// mergeEncodedHistograms decodes and merges per-second histograms, or returns
+// nil when there are none.
+func mergeEncodedHistograms(encoded map[uint64]string) (*hdrhistogram.Histogram, error) {
+	var merged *hdrhistogram.Histogram
+	for ts, v := range encoded {
+		hist, err := hdrhistogram.Decode([]byte(v))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode the histogram of second %d: %v", ts, err)
+		}
+		if merged == nil {
+			merged = hdrhistogram.New(hist.LowestTrackableValue(), hist.HighestTrackableValue(), int(hist.SignificantFigures()))
+		}
+		merged.Merge(hist)
+	}
+	return merged, nil
+}
+
+// distribution reconstructs the latency distribution of all commands and of
+// each label from the per-second histograms.
+func (r *reportResult) distribution() (distribution, error) {
+	var d distribution
+	add := func(name string, encoded map[uint64]string) error {
+		hist, err := mergeEncodedHistograms(encoded)
+		if err != nil || hist == nil || hist.TotalCount() == 0 {
+			return err
+		}
+		values := make([]float64, len(distributionPercentiles))
+		for i, p := range distributionPercentiles {
+			v := hist.ValueAtQuantile(p)
+			if p == 0 {
+				v = hist.Min()
+			}
+			values[i] = float64(v) / r.unitsPerMilli()
+		}
+		d.Series = append(d.Series, name)
+		d.Values = append(d.Values, values)
+		return nil
+	}
+	if err := add("allCommands", r.PerSecondEncodedHistograms); err != nil {
+		return d, err
+	}
+	for _, label := range labelKeys[1:] {
+		if err := add(label, r.PerSecondEncodedLabelHistograms[label]); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+// distributionChart plots latency against the percentile on the usual
+// 1/(1-percentile) log scale, the max being drawn one decade past 99.999.
+func distributionChart(title string, names []string, values [][]float64) lineChart {
+	chart := lineChart{Title: title, XLabel: "percentile", YLabel: "ms"}
+	chart.XTicks = []chartTick{{0, "0%"}, {1, "90%"}, {2, "99%"}, {3, "99.9%"}, {4, "99.99%"}, {5, "99.999%"}, {6, "max"}}
+	for i, name := range names {
+		series := chartSeries{Name: name}
+		for j, p := range distributionPercentiles {
+			x := 6.0
+			if p < 100 {
+				x = -math.Log10(1 - p/100)
+			}
+			series.Points = append(series.Points, chartPoint{X: x, Y: values[i][j]})
+		}
+		chart.Series = append(chart.Series, series)
+	}
+	return chart
+}
+
+// comparison sets several results side by side.
+type comparison struct {
+	Header       []string
+	Rows         [][]string
+	Throughput   lineChart
+	Distribution lineChart
+}
+
+// comparisonHeader are the columns of comparison.Rows but the last one, the
+// latency of each result's tailQuantileKey.
+var comparisonHeader = []string{"Result", "Duration (s)", "Total ops", "Errors", "ops/sec", "q50 (ms)"}
+
+// newComparison returns the comparison of the results, or nil for a single
+// one.
+func newComparison(results []*reportResult, sections []reportSection) *comparison {
+	if len(results) < 2 {
+		return nil
+	}
+	c := &comparison{
+		Throughput: lineChart{Title: "Throughput (all commands)", XLabel: "seconds", YLabel: "ops/sec"},
+	}
+	tails := make([]string, len(results))
+	sameTail := true
+	for i, r := range results {
+		tails[i] = r.tailQuantileKey(sections[i].QuantileKeys)
+		sameTail = sameTail && tails[i] == tails[0]
+	}
+	// the tail column is named after the key the results share, if they do
+	tailHeader := "tail (ms)"
+	if sameTail && tails[0] != "" {
+		tailHeader = tails[0] + " (ms)"
+	}
+	c.Header = append(append([]string{}, comparisonHeader...), tailHeader)
+	var names []string
+	var values [][]float64
+	for i, r := range results {
+		all := r.OverallQuantiles["allCommands"]
+		tail := ""
+		if tails[i] != "" {
+			tail = strconv.FormatFloat(all[tails[i]], 'f', 3, 64)
+			if !sameTail {
+				tail += " (" + tails[i] + ")"
+			}
+		}
+		c.Rows = append(c.Rows, []string{
+			r.Name,
+			strconv.FormatFloat(float64(r.DurationMillis)/1000, 'f', 1, 64),
+			formatTotal(r.Totals["TotalOps"]),
+			formatTotal(r.Totals["Errors"]),
+			formatRate(r.OverallRates["overallOpsRate"]),
+			strconv.FormatFloat(all["q50"], 'f', 3, 64),
+			tail,
+		})
+		c.Throughput.Series = append(c.Throughput.Series, chartSeries{Name: r.Name, Points: r.seriesPoints("allCommandsTs", "rate")})
+		d := sections[i].Distribution
+		if len(d.Series) > 0 && d.Series[0] == "allCommands" {
+			names = append(names, r.Name)
+			values = append(values, d.Values[0])
+		}
+	}
+	c.Distribution = distributionChart("Latency percentile distribution (all commands)", names, values)
+	return c
+}
+
+// formatTotal formats a decoded Totals value, missing ones being left empty.
+// Counts decode as float64, so they are formatted like flatten does rather
+// than in scientific notation.
+func formatTotal(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// formatRate formats a decoded OverallRates value as a whole number of
+// operations per second.
+func formatRate(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', 0, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// percentileLabel formats a distributionPercentiles entry, e.g. 99.9%.
+func percentileLabel(p float64) string {
+	if p == 100 {
+		return "max"
+	}
+	if p == 0 {
+		return "min"
+	}
+	return strconv.FormatFloat(p, 'f', -1, 64) + "%"
+}
+
+// renderMarkdownReport renders the report as Markdown tables; the charts are
+// only in the HTML report, the percentile distributions being tabulated
+// instead.
+func renderMarkdownReport(title string, c *comparison, sections []reportSection) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	if c != nil {
+		b.WriteString("## Comparison\n\n")
+		writeMarkdownTable(&b, c.Header, c.Rows)
+	}
+	for _, s := range sections {
+		fmt.Fprintf(&b, "## %s\n\n### Configuration\n\n", s.Name)
+		writeMarkdownTable(&b, []string{"Name", "Value"}, pairRows(s.Config))
+		b.WriteString("### Totals\n\n")
+		writeMarkdownTable(&b, []string{"Name", "Value"}, pairRows(s.Totals))
+		if len(s.Quantiles) > 0 {
+			b.WriteString("### Latency quantiles (ms)\n\n")
+			writeMarkdownTable(&b, append([]string{"Key"}, s.QuantileKeys...), quantileRows(s.Quantiles))
+		}
+		if len(s.Distribution.Series) > 0 {
+			b.WriteString("### Latency percentile distribution (ms)\n\n")
+			header := append([]string{"Percentile"}, s.Distribution.Series...)
+			var rows [][]string
+			for i, p := range distributionPercentiles {
+				row := []string{percentileLabel(p)}
+				for _, values := range s.Distribution.Values {
+					row = append(row, strconv.FormatFloat(values[i], 'f', 3, 64))
+				}
+				rows = append(rows, row)
+			}
+			writeMarkdownTable(&b, header, rows)
+		}
+	}
+	return b.String()
+}
+
+func pairRows(pairs [][2]string) [][]string {
+	rows := make([][]string, 0, len(pairs))
+	for _, p := range pairs {
+		rows = append(rows, []string{p[0], p[1]})
+	}
+	return rows
+}
+
+func quantileRows(quantiles []quantileRow) [][]string {
+	rows := make([][]string, 0, len(quantiles))
+	for _, q := range quantiles {
+		row := []string{q.Key}
+		for _, v := range q.Values {
+			row = append(row, strconv.FormatFloat(v, 'f', 3, 64))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// markdownEscaper keeps table cells on their row and column.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+func writeMarkdownTable(b *strings.Builder, header []string, rows [][]string) {
+	writeRow := func(cells []string) {
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" " + markdownEscaper.Replace(cell) + " |")
+		}
+		b.WriteString("\n")
+	}
+	writeRow(header)
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	writeRow(separator)
+	for _, row := range rows {
+		writeRow(row)
+	}
+	b.WriteString("\n")
+}
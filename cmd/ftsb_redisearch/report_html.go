@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// lineChart is an SVG line chart of the HTML report.
+type lineChart struct {
+	Title          string
+	XLabel, YLabel string
+	XTicks         []chartTick // nil for evenly spaced ticks
+	Series         []chartSeries
+}
+
+type chartSeries struct {
+	Name   string
+	Points []chartPoint
+}
+
+type chartPoint struct {
+	X, Y float64
+}
+
+type chartTick struct {
+	Value float64
+	Label string
+}
+
+// chartColors are the series colors, reused past the last one.
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+// Chart geometry, in SVG user units.
+const (
+	chartWidth       = 720
+	chartHeight      = 320
+	chartMarginLeft  = 70
+	chartMarginRight = 150
+	chartMarginTop   = 30
+	chartMarginBot   = 45
+)
+
+// niceTicks returns about n evenly spaced round ticks from 0 to at least max.
+func niceTicks(max float64, n int) []chartTick {
+	if max <= 0 || math.IsNaN(max) || math.IsInf(max, 0) {
+		max = 1
+	}
+	raw := max / float64(n)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		step = m * magnitude
+		if step >= raw {
+			break
+		}
+	}
+	var ticks []chartTick
+	for v := 0.0; ; v += step {
+		ticks = append(ticks, chartTick{Value: v, Label: strconv.FormatFloat(v, 'g', 6, 64)})
+		if v >= max {
+			break
+		}
+	}
+	return ticks
+}
+
+// SVG renders the chart, or an empty string when it has no points.
+func (c lineChart) SVG() template.HTML {
+	maxX, maxY := 0.0, 0.0
+	points := 0
+	for _, s := range c.Series {
+		for _, p := range s.Points {
+			maxX = math.Max(maxX, p.X)
+			maxY = math.Max(maxY, p.Y)
+			points++
+		}
+	}
+	if points == 0 {
+		return ""
+	}
+	xTicks := c.XTicks
+	if xTicks == nil {
+		xTicks = niceTicks(maxX, 8)
+	}
+	yTicks := niceTicks(maxY, 5)
+	xMax := xTicks[len(xTicks)-1].Value
+	yMax := yTicks[len(yTicks)-1].Value
+	plotWidth := float64(chartWidth - chartMarginLeft - chartMarginRight)
+	plotHeight := float64(chartHeight - chartMarginTop - chartMarginBot)
+	x := func(v float64) float64 { return chartMarginLeft + v/xMax*plotWidth }
+	y := func(v float64) float64 { return chartMarginTop + plotHeight - v/yMax*plotHeight }
+	esc := template.HTMLEscapeString
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" font-family="sans-serif" font-size="11">`, chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="14" font-weight="bold">%s</text>`, chartMarginLeft, esc(c.Title))
+	for _, t := range yTicks {
+		fmt.Fprintf(&b, `<line x1="%d" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#ddd"/>`, chartMarginLeft, x(xMax), y(t.Value), y(t.Value))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`, chartMarginLeft-5, y(t.Value), esc(t.Label))
+	}
+	for _, t := range xTicks {
+		fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%.1f" stroke="#ddd"/>`, x(t.Value), x(t.Value), chartMarginTop, y(0))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, x(t.Value), y(0)+15, esc(t.Label))
+	}
+	fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, x(xMax/2), chartHeight-5, esc(c.XLabel))
+	fmt.Fprintf(&b, `<text transform="translate(15 %.1f) rotate(-90)" text-anchor="middle">%s</text>`, y(yMax/2), esc(c.YLabel))
+	for i, s := range c.Series {
+		color := chartColors[i%len(chartColors)]
+		coords := make([]string, 0, len(s.Points))
+		for _, p := range s.Points {
+			coords = append(coords, fmt.Sprintf("%.1f,%.1f", x(p.X), y(p.Y)))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"><title>%s</title></polyline>`, color, strings.Join(coords, " "), esc(s.Name))
+		legendY := chartMarginTop + 16*i
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="3" fill="%s"/>`, chartWidth-chartMarginRight+15, legendY+4, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" dominant-baseline="middle">%s</text>`, chartWidth-chartMarginRight+32, legendY+6, esc(s.Name))
+	}
+	b.WriteString(`</svg>`)
+	// every dynamic string above is escaped
+	return template.HTML(b.String())
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms":         func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) },
+	"percentile": percentileLabel,
+	"at":         func(values []float64, i int) float64 { return values[i] },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; font-size: 13px; }
+th, td { border: 1px solid #ccc; padding: 3px 8px; text-align: left; }
+td.num { text-align: right; font-family: monospace; }
+th { background: #f3f3f3; }
+section { border-top: 2px solid #888; margin-top: 2em; }
+svg { display: block; margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{with .Comparison}}
+<section>
+<h2>Comparison</h2>
+<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{.Throughput.SVG}}
+{{.Distribution.SVG}}
+</section>
+{{end}}
+{{range $s := .Sections}}
+<section>
+<h2>{{.Name}}</h2>
+<h3>Configuration</h3>
+<table>
+{{range .Config}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+<h3>Totals</h3>
+<table>
+{{range .Totals}}<tr><th>{{index . 0}}</th><td class="num">{{index . 1}}</td></tr>
+{{end}}</table>
+{{if .Quantiles}}
+<h3>Latency quantiles (ms)</h3>
+<table>
+<tr><th>Key</th>{{range .QuantileKeys}}<th>{{.}}</th>{{end}}</tr>
+{{range .Quantiles}}<tr><th>{{.Key}}</th>{{range .Values}}<td class="num">{{ms .}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+<h3>Charts</h3>
+{{.Throughput.SVG}}
+{{range .Latency}}{{.SVG}}
+{{end}}
+{{if .Distribution.Series}}
+<h3>Latency percentile distribution (ms)</h3>
+{{.DistributionChart.SVG}}
+<table>
+<tr><th>Percentile</th>{{range .Distribution.Series}}<th>{{.}}</th>{{end}}</tr>
+{{range $i, $p := $.Percentiles}}<tr><th>{{percentile $p}}</th>{{range $s.Distribution.Values}}<td class="num">{{ms (at . $i)}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
+
+// renderHTMLReport renders the report as a single HTML page with inline SVG
+// charts, needing no other file or network access to be viewed.
+func renderHTMLReport(title string, c *comparison, sections []reportSection) (string, error) {
+	var b strings.Builder
+	err := reportTemplate.Execute(&b, struct {
+		Title       string
+		Comparison  *comparison
+		Sections    []reportSection
+		Percentiles []float64
+	}{title, c, sections, distributionPercentiles})
+	return b.String(), err
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+
+	"github.com/RediSearch/ftsb/benchmark_runner"
+)
+
+// Keys map to the recorded percentiles, as q25 may be 25 or 2.5, and to the
+// default ones for results without them.
+func TestQuantilePercentile(t *testing.T) {
+	recorded := &reportResult{Percentiles: map[string]float64{"q05": 0.5, "q25": 2.5, "q50": 50, "q9999": 99.99}}
+	for key, want := range map[string]float64{"q05": 0.5, "q25": 2.5, "q50": 50, "q9999": 99.99} {
+		if got, ok := recorded.quantilePercentile(key); !ok || got != want {
+			t.Errorf("quantilePercentile(%q) = %v, %v, want %v", key, got, ok, want)
+		}
+	}
+	if _, ok := recorded.quantilePercentile("q99"); ok {
+		t.Errorf("quantilePercentile(q99) should be unknown when not recorded")
+	}
+	legacy := &reportResult{}
+	for key, want := range map[string]float64{"q0": 0, "q50": 50, "q95": 95, "q99": 99, "q999": 99.9, "q100": 100} {
+		if got, ok := legacy.quantilePercentile(key); !ok || got != want {
+			t.Errorf("quantilePercentile(%q) = %v, %v, want %v", key, got, ok, want)
+		}
+	}
+	if _, ok := legacy.quantilePercentile("q25"); ok {
+		t.Errorf("quantilePercentile(q25) should be unknown without recorded percentiles")
+	}
+}
+
+func TestQuantileTableOrder(t *testing.T) {
+	r := &reportResult{
+		Percentiles: map[string]float64{"q05": 0.5, "q25": 2.5, "q50": 50, "q90": 90},
+		OverallQuantiles: map[string]map[string]float64{
+			"allCommands": {"q90": 3, "q50": 2, "q25": 1, "q05": 1, "qx": 4},
+		},
+	}
+	keys, _ := r.quantileTable()
+	if want := []string{"q05", "q25", "q50", "q90", "qx"}; strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("quantileTable keys = %v, want %v", keys, want)
+	}
+	if tail := r.tailQuantileKey(keys); tail != "q90" {
+		t.Errorf("tailQuantileKey = %q, want q90", tail)
+	}
+}
+
+// encodeSecond returns a per-second histogram of the given latencies (ns).
+func encodeSecond(t *testing.T, latencies ...int64) string {
+	hist := hdrhistogram.New(1, 1000000000, 3)
+	for _, v := range latencies {
+		if err := hist.RecordValue(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encoded, err := hist.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encoded)
+}
+
+// The report reconstructs the distributions from the per-second histograms in
+// the result's latency unit, and renders both formats for several results.
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	result := map[string]interface{}{
+		"ResultFormatVersion": "0.1",
+		"Workers":             8,
+		"LatencyUnit":         "ns",
+		"StartTime":           1000000,
+		"DurationMillis":      2000,
+		"DBSpecificConfigs":   map[string]interface{}{"host": "localhost:6379"},
+		"Totals":              map[string]interface{}{"TotalOps": 15000000, "ErrorsByClass": map[string]uint64{"OOM": 1}},
+		"OverallRates":        map[string]interface{}{"overallOpsRate": 2.0, "txByteRateStr": "1K"},
+		"OverallQuantiles": map[string]map[string]float64{
+			"allCommands": {"q50": 2, "q999": 4, "q100": 4},
+			"read":        {"q50": 2, "q999": 4, "q100": 4},
+			"write":       {"q50": 0, "q999": 0, "q100": 0},
+			"READ-R1":     {"q50": 2, "q999": 4, "q100": 4},
+		},
+		"TimeSeries": map[string][]benchmark_runner.DataPoint{
+			"allCommandsTs": {{Timestamp: 1000, MultiValues: map[string]float64{"rate": 2, "q50": 1}}, {Timestamp: 1001, MultiValues: map[string]float64{"rate": 2, "q50": 3}}},
+			"readTs":        {{Timestamp: 1000, MultiValues: map[string]float64{"rate": 2, "q50": 1}}, {Timestamp: 1001, MultiValues: map[string]float64{"rate": 2, "q50": 3}}},
+		},
+		"PerSecondEncodedHistograms": map[uint64]string{
+			1000: encodeSecond(t, 1000000, 1000000),
+			1001: encodeSecond(t, 3000000, 4000000),
+		},
+		"PerSecondEncodedLabelHistograms": map[string]map[uint64]string{
+			"read": {1000: encodeSecond(t, 1000000, 1000000), 1001: encodeSecond(t, 3000000, 4000000)},
+		},
+	}
+	var inputs []string
+	for _, name := range []string{"a.json", "b.json"} {
+		data, err := json.Marshal(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileName := filepath.Join(dir, name)
+		if err := os.WriteFile(fileName, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, fileName)
+	}
+	htmlOut, markdownOut := filepath.Join(dir, "report.html"), filepath.Join(dir, "report.md")
+	if err := runReport(append([]string{"-html-out", htmlOut, "-markdown-out", markdownOut, "-title", "<nightly>"}, inputs...)); err != nil {
+		t.Fatal(err)
+	}
+
+	markdown, err := os.ReadFile(markdownOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# <nightly>",
+		"| Result | Duration (s) | Total ops | Errors | ops/sec | q50 (ms) | q999 (ms) |",
+		"| a.json | 2.0 | 15000000 |  | 2 | 2.000 | 4.000 |",
+		"| host | localhost:6379 |",
+		"| ErrorsByClass.OOM | 1 |",
+		"| txByteRateStr | 1K |",
+		"| Key | q50 | q999 | q100 |",
+		"| READ-R1 | 2.000 | 4.000 | 4.000 |",
+		"| Percentile | allCommands | read |",
+		"| 50% | 1.000 | 1.000 |",
+		"| max | 4.002 | 4.002 |", // highest value equivalent to 4ms at 3 significant figures
+	} {
+		if !strings.Contains(string(markdown), want) {
+			t.Errorf("Markdown report is missing %q:\n%s", want, markdown)
+		}
+	}
+	if strings.Contains(string(markdown), "| write |") {
+		t.Errorf("Markdown report should skip the labels without commands:\n%s", markdown)
+	}
+
+	html, err := os.ReadFile(htmlOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>&lt;nightly&gt;</title>",
+		">Throughput (all commands)</text>",
+		">Latency percentile distribution</text>",
+		">q50 latency</text>",
+		">99.999%</text>",
+		"<polyline",
+	} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("HTML report is missing %q", want)
+		}
+	}
+	if strings.Contains(string(html), "<nightly>") {
+		t.Errorf("HTML report should escape the title")
+	}
+}
+
+func TestReportRequiresResults(t *testing.T) {
+	if err := runReport([]string{"-html-out", ""}); err == nil {
+		t.Errorf("runReport without result files should fail")
+	}
+}
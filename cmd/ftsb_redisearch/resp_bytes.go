@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// respRequestLen returns the exact number of bytes radix writes for the
+// command cmd args...: a RESP array header followed by one bulk string per
+// element, i.e. *<n>\r\n then $<len>\r\n<arg>\r\n for each of them.
+func respRequestLen(cmd string, args []string) uint64 {
+	n := respHeaderLen(len(args)+1) + respBulkLen(len(cmd))
+	for _, arg := range args {
+		n += respBulkLen(len(arg))
+	}
+	return n
+}
+
+// respHeaderLen is the size of a *<n>\r\n (or $<n>\r\n) header.
+func respHeaderLen(n int) uint64 {
+	return uint64(1 + len(strconv.Itoa(n)) + 2)
+}
+
+func respBulkLen(size int) uint64 {
+	return respHeaderLen(size) + uint64(size) + 2
+}
+
+// capturedReply is the --capture-replies receiver. It keeps the exact RESP
+// bytes of the reply, so RxBytes counts what came over the wire including the
+// framing, and defers decoding the value (see value) until after the latency
+// has been measured. Error replies are still returned as resp2.Error, exactly
+// as with a decoding receiver, so command errors and pipelines behave the same.
+type capturedReply struct {
+	raw resp2.RawMessage
+}
+
+func (r *capturedReply) UnmarshalRESP(br *bufio.Reader) error {
+	b, err := br.Peek(1)
+	if err != nil {
+		return err
+	}
+	if b[0] != resp2.ErrorPrefix[0] {
+		return r.raw.UnmarshalRESP(br)
+	}
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		return err
+	}
+	r.raw = append(r.raw[:0], line...)
+	return resp2.Error{E: errors.New(string(bytes.TrimSuffix(line[1:], []byte("\r\n"))))}
+}
+
+// wireLen returns the reply size in bytes, framing included.
+func (r *capturedReply) wireLen() uint64 {
+	return uint64(len(r.raw))
+}
+
+// value decodes the captured reply the way an *interface{} receiver would
+// have, or returns nil for an error reply or one that cannot be decoded.
+func (r *capturedReply) value() interface{} {
+	var v interface{}
+	if len(r.raw) == 0 || r.raw[0] == resp2.ErrorPrefix[0] {
+		return nil
+	}
+	if err := r.raw.UnmarshalInto(resp2.Any{I: &v}); err != nil {
+		return nil
+	}
+	return v
+}
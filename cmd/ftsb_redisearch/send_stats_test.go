@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/RediSearch/ftsb/benchmark_runner"
 	radix "github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
 )
 
 // fakeClient is a radix.Client whose Do returns a canned error (nil = success).
@@ -55,33 +59,53 @@ func TestSendFlatCmdRecordsSentBytesAsTx(t *testing.T) {
 	}
 }
 
-func TestGetRxLen(t *testing.T) {
-	if got := getRxLen("abc"); got != 3 {
-		t.Fatalf("getRxLen(string) = %d, want 3", got)
+func TestCapturedReplyWireLen(t *testing.T) {
+	tests := []struct {
+		raw     string
+		wantErr string
+	}{
+		{"+OK\r\n", ""},
+		{":12345\r\n", ""},
+		{"$-1\r\n", ""},
+		{"$5\r\nhello\r\n", ""},
+		{"*3\r\n:2\r\n$5\r\ndoc:1\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n", ""},
+		{"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", "WRONGTYPE Operation against a key holding the wrong kind of value"},
 	}
-	if got := getRxLen([]byte("abcd")); got != 4 {
-		t.Fatalf("getRxLen([]byte) = %d, want 4", got)
+	for _, tt := range tests {
+		// a trailing reply must be left unread for the next command
+		br := bufio.NewReader(strings.NewReader(tt.raw + "+NEXT\r\n"))
+		reply := new(capturedReply)
+		err := reply.UnmarshalRESP(br)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("UnmarshalRESP(%q) error: %v", tt.raw, err)
+		}
+		if tt.wantErr != "" {
+			var respErr resp2.Error
+			if !errors.As(err, &respErr) || err.Error() != tt.wantErr {
+				t.Errorf("UnmarshalRESP(%q) error = %v, want resp2.Error %q", tt.raw, err, tt.wantErr)
+			}
+		}
+		if got := reply.wireLen(); got != uint64(len(tt.raw)) {
+			t.Errorf("wireLen(%q) = %d, want %d", tt.raw, got, len(tt.raw))
+		}
+		if rest, _ := br.ReadString('\n'); rest != "+NEXT\r\n" {
+			t.Errorf("UnmarshalRESP(%q) consumed the next reply, left %q", tt.raw, rest)
+		}
 	}
-	if got := getRxLen([]string{"ab", "cde"}); got != 5 {
-		t.Fatalf("getRxLen([]string) = %d, want 5", got)
-	}
-	// Arrays are summed recursively (e.g. an FT.SEARCH reply of mixed elements).
-	if got := getRxLen([]interface{}{"ab", []byte("cd"), int64(100)}); got != 2+2+3 {
-		t.Fatalf("getRxLen([]interface{}) = %d, want 7", got)
-	}
-	if got := getRxLen(int64(12345)); got != 5 {
-		t.Fatalf("getRxLen(int64) = %d, want 5", got)
-	}
-	// The production path stores a *interface{} receiver; it must be dereferenced.
-	var boxed interface{} = []byte("hello")
-	if got := getRxLen(&boxed); got != 5 {
-		t.Fatalf("getRxLen(*interface{}) = %d, want 5", got)
+}
+
+func TestCapturedReplyValue(t *testing.T) {
+	reply := new(capturedReply)
+	raw := "*3\r\n:2\r\n$5\r\ndoc:1\r\n*0\r\n"
+	if err := reply.UnmarshalRESP(bufio.NewReader(strings.NewReader(raw))); err != nil {
+		t.Fatal(err)
 	}
-	if got := getRxLen(nil); got != 0 {
-		t.Fatalf("getRxLen(nil) = %d, want 0", got)
+	arr, ok := reply.value().([]interface{})
+	if !ok || len(arr) != 3 || arr[0] != int64(2) {
+		t.Fatalf("value() = %#v, want the decoded 3 element array", reply.value())
 	}
-	if got := getRxLen(42); got != 0 {
-		t.Fatalf("getRxLen(int) = %d, want 0 (untyped int not a RESP reply type)", got)
+	if results, ok := replyResultCount("FT.SEARCH", reply); !ok || results != 2 {
+		t.Errorf("replyResultCount = %d, %v, want 2, true", results, ok)
 	}
 }
 
@@ -141,6 +165,9 @@ func TestSendFlatCmdMarksTimeout(t *testing.T) {
 	if !entries[0].Error() {
 		t.Fatal("a timeout is also an error")
 	}
+	if got := entries[0].ErrorClass(); got != errorClassTimeout {
+		t.Fatalf("ErrorClass() = %q, want %q", got, errorClassTimeout)
+	}
 	if got := entries[0].Tx(); got != 64 {
 		t.Fatalf("Tx() = %d, want 64 (sent bytes recorded even on timeout)", got)
 	}
@@ -192,3 +219,105 @@ func TestPipelineRecordsPerCommandTxAndDoesNotPanic(t *testing.T) {
 		t.Fatalf("pipelined commands share one round-trip; latencies should be equal: %d != %d", c1.Latency(), c2.Latency())
 	}
 }
+
+// --pipeline-max-linger: a window that has not reached --pipeline commands is
+// still flushed once its oldest command has waited the linger, so low-rate runs
+// don't stall commands behind an unfilled window.
+func TestPipelineMaxLingerFlushesPartialWindow(t *testing.T) {
+	savedPipeline, savedLinger := pipeline, pipelineMaxLinger
+	pipeline, pipelineMaxLinger = 100, time.Millisecond
+	defer func() { pipeline, pipelineMaxLinger = savedPipeline, savedLinger }()
+
+	p := &processor{cmdChan: make(chan benchmark_runner.Stat, 2)}
+	client := &fakeClient{}
+
+	var pending []pendingCmd
+	pending, _ = sendFlatCmd(p, client, "WRITE", "w1", "HSET", []string{"doc:1"}, 100, pending)
+	if len(pending) != 1 || client.calls != 0 {
+		t.Fatalf("first command should buffer: pending=%d calls=%d", len(pending), client.calls)
+	}
+	if _, ok := lingerDeadline(pending); !ok {
+		t.Fatal("lingerDeadline should report a deadline for a non-empty window")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	pending, _ = sendFlatCmd(p, client, "WRITE", "w2", "HSET", []string{"doc:2"}, 200, pending)
+	if len(pending) != 0 {
+		t.Fatalf("window older than the linger should be flushed, %d still buffered", len(pending))
+	}
+	if client.calls != 1 {
+		t.Fatalf("expected exactly one pipelined round-trip, got %d", client.calls)
+	}
+	if got := len(p.cmdChan); got != 2 {
+		t.Fatalf("expected a stat per flushed command, got %d", got)
+	}
+}
+
+// A partial window is due once its linger passes even when no row comes in:
+// lingerTimer wakes the worker blocked on the rows channel.
+func TestLingerTimerFiresWithoutRows(t *testing.T) {
+	savedLinger := pipelineMaxLinger
+	pipelineMaxLinger = 5 * time.Millisecond
+	defer func() { pipelineMaxLinger = savedLinger }()
+
+	rows := make(chan string, 1)
+	var linger lingerTimer
+	defer linger.stop()
+
+	// nothing buffered: the worker just waits for rows
+	rows <- "row"
+	if row, more, expired := linger.next(rows, [][]pendingCmd{nil}); row != "row" || !more || expired {
+		t.Fatalf("next = %q, %v, %v, want the row", row, more, expired)
+	}
+
+	start := time.Now()
+	slots := [][]pendingCmd{nil, {{queuedAt: start}}}
+	if _, _, expired := linger.next(rows, slots); !expired {
+		t.Fatal("next should report the expired linger without rows")
+	}
+	if waited := time.Since(start); waited < pipelineMaxLinger {
+		t.Fatalf("next returned after %v, before the %v linger", waited, pipelineMaxLinger)
+	}
+
+	close(rows)
+	if _, more, expired := linger.next(rows, [][]pendingCmd{nil}); more || expired {
+		t.Fatalf("next = more %v, expired %v, want the end of the rows", more, expired)
+	}
+}
+
+// With the linger disabled (the default) only the command count triggers a
+// flush, preserving the historical behavior.
+func TestLingerDeadlineDisabledByDefault(t *testing.T) {
+	savedLinger := pipelineMaxLinger
+	pipelineMaxLinger = 0
+	defer func() { pipelineMaxLinger = savedLinger }()
+
+	if _, ok := lingerDeadline([]pendingCmd{{queuedAt: time.Now().Add(-time.Hour)}}); ok {
+		t.Fatal("lingerDeadline must be disabled when --pipeline-max-linger is 0")
+	}
+}
+
+func TestReplyResultCount(t *testing.T) {
+	search := []interface{}{int64(2), "doc:1", []interface{}{"f", "v"}, "doc:2", []interface{}{"f", "v"}}
+	cursor := []interface{}{[]interface{}{int64(7), []interface{}{"f", "v"}}, int64(1234)}
+	tests := []struct {
+		cmd    string
+		reply  interface{}
+		want   uint64
+		wantOk bool
+	}{
+		{"FT.SEARCH", search, 2, true},
+		{"ft.search", []interface{}{int64(0)}, 0, true},
+		{"FT.AGGREGATE", cursor, 7, true},
+		{"FT.CURSOR", cursor, 7, true},
+		{"HSET", int64(3), 0, false},
+		{"FT.SEARCH", "OK", 0, false},
+		{"FT.SEARCH", []interface{}{}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := replyResultCount(tt.cmd, tt.reply)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("replyResultCount(%s, %v) = %d, %v, want %d, %v", tt.cmd, tt.reply, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
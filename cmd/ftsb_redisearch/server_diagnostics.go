@@ -0,0 +1,194 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	radix "github.com/mediocregopher/radix/v3"
+)
+
+// slowlogEntries is how many SLOWLOG entries are fetched per server, the
+// default slowlog-max-len.
+const slowlogEntries = 128
+
+// ResetServerDiagnostics resets SLOWLOG and the LATENCY monitor of every
+// server before the benchmark clock starts, so the entries captured after the
+// run are the run's own. A server refusing the reset (e.g. ACL NOPERM) is
+// warned about, and its captured entries may then predate the run.
+func (b *benchmark) ResetServerDiagnostics() {
+	if !serverDiagnostics {
+		return
+	}
+	client, err := dialSideClient()
+	if err != nil {
+		log.Printf("Warning! Cannot reset SLOWLOG and LATENCY: %v", err)
+		return
+	}
+	defer client.Close()
+	nodes, err := sideClientNodes(client)
+	if err != nil {
+		log.Printf("Warning! Cannot reset SLOWLOG and LATENCY: %v", err)
+		return
+	}
+	for addr, node := range nodes {
+		if err := node.Do(radix.Cmd(nil, "SLOWLOG", "RESET")); err != nil {
+			log.Printf("Warning! SLOWLOG RESET on %s failed, its SLOWLOG may hold entries from before the run: %v", addr, err)
+		}
+		if err := node.Do(radix.Cmd(nil, "LATENCY", "RESET")); err != nil {
+			log.Printf("Warning! LATENCY RESET on %s failed, its LATENCY events may predate the run: %v", addr, err)
+		}
+	}
+}
+
+// GetServerDiagnosticsMap captures SLOWLOG GET, LATENCY LATEST and LATENCY
+// HISTOGRAM of every server, by address. A command the server refuses or does
+// not know (LATENCY HISTOGRAM needs Redis 7) is reported as <name>Error.
+func (b *benchmark) GetServerDiagnosticsMap() map[string]interface{} {
+	if !serverDiagnostics {
+		return nil
+	}
+	client, err := dialSideClient()
+	if err != nil {
+		log.Printf("Warning! Cannot capture SLOWLOG and LATENCY: %v", err)
+		return nil
+	}
+	defer client.Close()
+	nodes, err := sideClientNodes(client)
+	if err != nil {
+		log.Printf("Warning! Cannot capture SLOWLOG and LATENCY: %v", err)
+		return nil
+	}
+	configs := map[string]interface{}{}
+	slowlogs, events := 0, 0
+	for addr, node := range nodes {
+		mp := map[string]interface{}{}
+		var slowlog []interface{}
+		if err := node.Do(radix.Cmd(&slowlog, "SLOWLOG", "GET", strconv.Itoa(slowlogEntries))); err != nil {
+			mp["SlowlogError"] = err.Error()
+		} else {
+			mp["Slowlog"] = parseSlowlog(slowlog)
+			slowlogs += len(slowlog)
+		}
+		var latest []interface{}
+		if err := node.Do(radix.Cmd(&latest, "LATENCY", "LATEST")); err != nil {
+			mp["LatencyLatestError"] = err.Error()
+		} else {
+			mp["LatencyLatest"] = parseLatencyLatest(latest)
+			events += len(latest)
+		}
+		var histogram []interface{}
+		if err := node.Do(radix.Cmd(&histogram, "LATENCY", "HISTOGRAM")); err != nil {
+			mp["LatencyHistogramError"] = err.Error()
+		} else {
+			mp["LatencyHistogram"] = parseLatencyHistogram(histogram)
+		}
+		configs[addr] = mp
+	}
+	log.Printf("Captured %d SLOWLOG entries and %d LATENCY events from %d servers\n", slowlogs, events, len(nodes))
+	return configs
+}
+
+// slowlogEntry is one SLOWLOG GET entry.
+type slowlogEntry struct {
+	Id             int64    `json:"Id"`
+	Timestamp      int64    `json:"Timestamp"`
+	DurationMicros int64    `json:"DurationMicros"`
+	Command        []string `json:"Command"`
+	Client         string   `json:"Client,omitempty"`
+	ClientName     string   `json:"ClientName,omitempty"`
+}
+
+// parseSlowlog parses a SLOWLOG GET reply: one [id, timestamp, duration
+// (microseconds), [args...], client address, client name] entry per command,
+// the last two since Redis 4.0.
+func parseSlowlog(reply []interface{}) []slowlogEntry {
+	entries := make([]slowlogEntry, 0, len(reply))
+	for _, v := range reply {
+		fields, ok := v.([]interface{})
+		if !ok || len(fields) < 4 {
+			continue
+		}
+		var entry slowlogEntry
+		entry.Id, _ = fields[0].(int64)
+		entry.Timestamp, _ = fields[1].(int64)
+		entry.DurationMicros, _ = fields[2].(int64)
+		if args, ok := fields[3].([]interface{}); ok {
+			for _, arg := range args {
+				if s, ok := respString(arg); ok {
+					entry.Command = append(entry.Command, s)
+				}
+			}
+		}
+		if len(fields) >= 6 {
+			entry.Client, _ = respString(fields[4])
+			entry.ClientName, _ = respString(fields[5])
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// latencyEvent is one LATENCY LATEST event.
+type latencyEvent struct {
+	Event     string `json:"Event"`
+	Timestamp int64  `json:"Timestamp"`
+	LatestMs  int64  `json:"LatestMs"`
+	MaxMs     int64  `json:"MaxMs"`
+}
+
+// parseLatencyLatest parses a LATENCY LATEST reply: one [event, timestamp,
+// latest (ms), max (ms)] entry per event.
+func parseLatencyLatest(reply []interface{}) []latencyEvent {
+	events := make([]latencyEvent, 0, len(reply))
+	for _, v := range reply {
+		fields, ok := v.([]interface{})
+		if !ok || len(fields) < 4 {
+			continue
+		}
+		var event latencyEvent
+		event.Event, _ = respString(fields[0])
+		event.Timestamp, _ = fields[1].(int64)
+		event.LatestMs, _ = fields[2].(int64)
+		event.MaxMs, _ = fields[3].(int64)
+		events = append(events, event)
+	}
+	return events
+}
+
+// parseLatencyHistogram parses a LATENCY HISTOGRAM reply, alternating command
+// names and [calls, n, histogram_usec, [bucket, count...]] details, into the
+// calls and per-bucket (upper bound in microseconds) counts of each command.
+func parseLatencyHistogram(reply []interface{}) map[string]interface{} {
+	commands := map[string]interface{}{}
+	for i := 0; i+1 < len(reply); i += 2 {
+		name, ok := respString(reply[i])
+		if !ok {
+			continue
+		}
+		details, ok := reply[i+1].([]interface{})
+		if !ok {
+			continue
+		}
+		mp := map[string]interface{}{}
+		for j := 0; j+1 < len(details); j += 2 {
+			field, _ := respString(details[j])
+			switch field {
+			case "calls":
+				mp["Calls"], _ = details[j+1].(int64)
+			case "histogram_usec":
+				buckets := map[string]int64{}
+				values, _ := details[j+1].([]interface{})
+				for k := 0; k+1 < len(values); k += 2 {
+					bucket, ok := values[k].(int64)
+					count, _ := values[k+1].(int64)
+					if ok {
+						buckets[strconv.FormatInt(bucket, 10)] = count
+					}
+				}
+				mp["HistogramUsec"] = buckets
+			}
+		}
+		commands[name] = mp
+	}
+	return commands
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSlowlog(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{int64(7), int64(1700000000), int64(15000),
+			[]interface{}{[]byte("FT.SEARCH"), []byte("idx"), []byte("@f:v")},
+			[]byte("127.0.0.1:50000"), []byte("")},
+		// before Redis 4.0 entries have no client
+		[]interface{}{int64(6), int64(1699999999), int64(12000), []interface{}{"HSET", "k", "f", "v"}},
+		"malformed",
+	}
+	want := []slowlogEntry{
+		{Id: 7, Timestamp: 1700000000, DurationMicros: 15000, Command: []string{"FT.SEARCH", "idx", "@f:v"}, Client: "127.0.0.1:50000"},
+		{Id: 6, Timestamp: 1699999999, DurationMicros: 12000, Command: []string{"HSET", "k", "f", "v"}},
+	}
+	if got := parseSlowlog(reply); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSlowlog = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseLatencyLatest(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{[]byte("command"), int64(1700000000), int64(12), int64(40)},
+		[]interface{}{"fork", int64(1700000001), int64(3), int64(3)},
+	}
+	want := []latencyEvent{
+		{Event: "command", Timestamp: 1700000000, LatestMs: 12, MaxMs: 40},
+		{Event: "fork", Timestamp: 1700000001, LatestMs: 3, MaxMs: 3},
+	}
+	if got := parseLatencyLatest(reply); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLatencyLatest = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseLatencyHistogram(t *testing.T) {
+	reply := []interface{}{
+		[]byte("ft.search"), []interface{}{
+			[]byte("calls"), int64(3),
+			[]byte("histogram_usec"), []interface{}{int64(1024), int64(2), int64(2048), int64(3)},
+		},
+	}
+	want := map[string]interface{}{
+		"ft.search": map[string]interface{}{
+			"Calls":         int64(3),
+			"HistogramUsec": map[string]int64{"1024": 2, "2048": 3},
+		},
+	}
+	if got := parseLatencyHistogram(reply); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLatencyHistogram = %v, want %v", got, want)
+	}
+}
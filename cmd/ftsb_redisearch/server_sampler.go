@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	radix "github.com/mediocregopher/radix/v3"
+
+	"github.com/RediSearch/ftsb/benchmark_runner"
+)
+
+// serverInfoSections are the INFO sections sampled with --server-stats, one
+// INFO call each so servers without multi-section INFO are supported.
+var serverInfoSections = []string{"memory", "cpu", "stats", "commandstats"}
+
+// serverInfoFields are the memory, cpu and stats fields recorded.
+var serverInfoFields = map[string]bool{
+	"used_memory":                true,
+	"used_memory_rss":            true,
+	"used_memory_peak":           true,
+	"used_memory_dataset":        true,
+	"used_cpu_sys":               true,
+	"used_cpu_user":              true,
+	"used_cpu_sys_main_thread":   true,
+	"used_cpu_user_main_thread":  true,
+	"total_connections_received": true,
+	"total_commands_processed":   true,
+	"instantaneous_ops_per_sec":  true,
+	"total_net_input_bytes":      true,
+	"total_net_output_bytes":     true,
+	"rejected_connections":       true,
+	"expired_keys":               true,
+	"evicted_keys":               true,
+	"keyspace_hits":              true,
+	"keyspace_misses":            true,
+	"total_error_replies":        true,
+}
+
+// commandStatFields are the fields recorded from each INFO commandstats line.
+var commandStatFields = map[string]bool{
+	"calls":          true,
+	"usec":           true,
+	"rejected_calls": true,
+	"failed_calls":   true,
+}
+
+// ftInfoFields are the FT.INFO fields recorded for each --server-stats-indexes
+// index.
+var ftInfoFields = map[string]bool{
+	"num_docs":                    true,
+	"max_doc_id":                  true,
+	"num_terms":                   true,
+	"num_records":                 true,
+	"inverted_sz_mb":              true,
+	"vector_index_sz_mb":          true,
+	"total_inverted_index_blocks": true,
+	"offset_vectors_sz_mb":        true,
+	"doc_table_size_mb":           true,
+	"sortable_values_size_mb":     true,
+	"key_table_size_mb":           true,
+	"total_index_memory_sz_mb":    true,
+	"indexing":                    true,
+	"percent_indexed":             true,
+	"hash_indexing_failures":      true,
+	"number_of_uses":              true,
+	"total_indexing_time":         true,
+}
+
+// serverSampler samples INFO and FT.INFO on a connection of its own. In
+// cluster mode INFO is summed over the primaries, while FT.INFO is sent to any
+// node, the coordinator aggregating it.
+type serverSampler struct {
+	client  radix.Client
+	indexes []string
+}
+
+// GetServerSampler returns the --server-stats sampler, or nil when disabled or
+// when its connection cannot be opened.
+func (b *benchmark) GetServerSampler() benchmark_runner.ServerSampler {
+	if !serverStats {
+		return nil
+	}
+	client, err := dialSideClient()
+	if err != nil {
+		log.Printf("Warning! Disabling server stats sampling, cannot connect: %v", err)
+		return nil
+	}
+	return &serverSampler{client: client, indexes: serverStatsIndexList()}
+}
+
+// serverStatsIndexList splits --server-stats-indexes.
+func serverStatsIndexList() []string {
+	var indexes []string
+	for _, index := range strings.Split(serverStatsIndexes, ",") {
+		if index = strings.TrimSpace(index); index != "" {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+func (s *serverSampler) SampleServer() (map[string]float64, error) {
+	sample := map[string]float64{}
+	for _, section := range serverInfoSections {
+		if err := s.sampleInfo(section, sample); err != nil {
+			return nil, err
+		}
+	}
+	for _, index := range s.indexes {
+		var reply []interface{}
+		if err := s.client.Do(radix.Cmd(&reply, "FT.INFO", index)); err != nil {
+			return nil, fmt.Errorf("FT.INFO %s: %v", index, err)
+		}
+		parseFtInfo(index, reply, sample)
+	}
+	return sample, nil
+}
+
+func (s *serverSampler) sampleInfo(section string, sample map[string]float64) error {
+	nodes, err := sideClientNodes(s.client)
+	if err != nil {
+		return fmt.Errorf("INFO %s: %v", section, err)
+	}
+	for addr, client := range nodes {
+		var info string
+		if err := client.Do(radix.Cmd(&info, "INFO", section)); err != nil {
+			return fmt.Errorf("INFO %s on %s: %v", section, addr, err)
+		}
+		parseInfo(info, sample)
+	}
+	return nil
+}
+
+func (s *serverSampler) Close() {
+	s.client.Close()
+}
+
+// parseInfo adds the serverInfoFields and the commandstats fields of an INFO
+// reply to sample, keyed e.g. used_memory or cmdstat_ft.search_calls. Values
+// already in sample are added to, summing the nodes of a cluster.
+func parseInfo(info string, sample map[string]float64) {
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(name, "cmdstat_") {
+			// cmdstat_get:calls=1,usec=2,usec_per_call=2.00,rejected_calls=0,failed_calls=0
+			for _, field := range strings.Split(value, ",") {
+				k, v, ok := strings.Cut(field, "=")
+				if !ok || !commandStatFields[k] {
+					continue
+				}
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					sample[name+"_"+k] += f
+				}
+			}
+			continue
+		}
+		if !serverInfoFields[name] {
+			continue
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			sample[name] += f
+		}
+	}
+}
+
+// parseFtInfo adds the ftInfoFields of an FT.INFO reply, a flat list of
+// alternating names and values, to sample keyed ft_info_<index>_<field>.
+func parseFtInfo(index string, reply []interface{}, sample map[string]float64) {
+	for i := 0; i+1 < len(reply); i += 2 {
+		name, ok := respString(reply[i])
+		if !ok || !ftInfoFields[name] {
+			continue
+		}
+		var value float64
+		switch v := reply[i+1].(type) {
+		case int64:
+			value = float64(v)
+		default:
+			str, ok := respString(v)
+			if !ok {
+				continue
+			}
+			f, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				continue
+			}
+			value = f
+		}
+		sample["ft_info_"+index+"_"+name] = value
+	}
+}
+
+// respString returns a decoded simple or bulk string reply as a string.
+func respString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
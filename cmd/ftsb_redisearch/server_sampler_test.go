@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseInfo(t *testing.T) {
+	info := "# Memory\r\nused_memory:1000\r\nused_memory_human:1000B\r\n# CPU\r\nused_cpu_sys:1.50\r\n" +
+		"# Commandstats\r\ncmdstat_ft.search:calls=3,usec=30,usec_per_call=10.00,rejected_calls=1,failed_calls=2\r\n"
+	sample := map[string]float64{}
+	parseInfo(info, sample)
+	want := map[string]float64{
+		"used_memory":                      1000,
+		"used_cpu_sys":                     1.5,
+		"cmdstat_ft.search_calls":          3,
+		"cmdstat_ft.search_usec":           30,
+		"cmdstat_ft.search_rejected_calls": 1,
+		"cmdstat_ft.search_failed_calls":   2,
+	}
+	if len(sample) != len(want) {
+		t.Errorf("parseInfo = %v, want %v", sample, want)
+	}
+	for k, v := range want {
+		if sample[k] != v {
+			t.Errorf("parseInfo %s = %v, want %v", k, sample[k], v)
+		}
+	}
+
+	// a second node's reply adds up, as in cluster mode
+	parseInfo(info, sample)
+	if sample["used_memory"] != 2000 || sample["cmdstat_ft.search_calls"] != 6 {
+		t.Errorf("parseInfo did not sum a second reply: %v", sample)
+	}
+}
+
+func TestParseFtInfo(t *testing.T) {
+	reply := []interface{}{
+		[]byte("index_name"), []byte("idx"),
+		[]byte("num_docs"), int64(42),
+		"inverted_sz_mb", []byte("1.25"),
+		"percent_indexed", "1",
+		"attributes", []interface{}{},
+		"num_terms", "nan?",
+	}
+	sample := map[string]float64{}
+	parseFtInfo("idx", reply, sample)
+	want := map[string]float64{
+		"ft_info_idx_num_docs":        42,
+		"ft_info_idx_inverted_sz_mb":  1.25,
+		"ft_info_idx_percent_indexed": 1,
+	}
+	if len(sample) != len(want) {
+		t.Errorf("parseFtInfo = %v, want %v", sample, want)
+	}
+	for k, v := range want {
+		if sample[k] != v {
+			t.Errorf("parseFtInfo %s = %v, want %v", k, sample[k], v)
+		}
+	}
+}